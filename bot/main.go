@@ -17,9 +17,11 @@ import (
 const (
 	tokenEnv                 = "TELEGRAM_BOT_TOKEN"
 	allowedUserIdsEnv        = "ALLOWED_USER_IDS"
+	adminUserIdsEnv          = "ADMIN_USER_IDS"
 	coordinatorServiceUrlEnv = "COORDINATOR_SERVICE_URL"
 	redisUrlEnv              = "REDIS_URL"
 	redisPasswordEnv         = "REDIS_PASSWORD"
+	watchDownloadsEnv        = "WATCH_DOWNLOADS"
 )
 
 func main() {
@@ -78,8 +80,31 @@ func main() {
 		allowedUserIds = append(allowedUserIds, id)
 	}
 
+	adminUserIds := make([]int64, 0)
+	if adminUsersStr, ok := os.LookupEnv(adminUserIdsEnv); ok && adminUsersStr != "" {
+		for _, s := range strings.Split(adminUsersStr, ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				log.Fatalf("Failed to parse admin user ID: %v", err)
+			}
+			adminUserIds = append(adminUserIds, id)
+		}
+	}
+
+	if len(adminUserIds) == 0 {
+		log.Printf("%s is not set, admin commands are disabled", adminUserIdsEnv)
+	}
+
+	// Stream progress updates from the coordinator instead of polling the Redis queue
+	watchDownloads := os.Getenv(watchDownloadsEnv) == "true"
+
 	// Create bot with dependencies
-	bot, err := bot.NewBot(token, allowedUserIds, coordClient, redisClient)
+	bot, err := bot.NewBot(token, allowedUserIds, adminUserIds, coordClient, redisClient, watchDownloads)
 	if err != nil {
 		log.Fatalf("Failed to create bot: %v", err)
 	}
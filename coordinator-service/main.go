@@ -5,21 +5,32 @@ import (
 	"log"
 	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/aquare11e/media-downloader-bot/common/protogen/common"
 	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
 	"github.com/aquare11e/media-downloader-bot/internal/coordinator"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection"
 )
 
+// shutdownTimeout is how long running calls get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	servicePort := getEnvOrRaise("SERVICE_PORT")
 
 	transmissionServiceURL := getEnvOrRaise("TRANSMISSION_SERVICE_URL")
-	plexServiceURL := getEnvOrRaise("PLEX_SERVICE_URL")
+	// Comma-separated list of media server services implementing the Plex service contract
+	plexServiceURLs := strings.Split(getEnvOrRaise("PLEX_SERVICE_URL"), ",")
 	redisURL := getEnvOrRaise("REDIS_URL")
 	redisPassword := os.Getenv("REDIS_PASSWORD")
 
@@ -31,6 +42,50 @@ func main() {
 		common.RequestType_SHORTS:          getEnvOrRaise("SHORTS_DIR_PATH"),
 	}
 
+	downloadWindows, err := coordinator.ParseTimeWindows(os.Getenv("DOWNLOAD_WINDOWS"))
+	if err != nil {
+		log.Fatalf("Failed to parse DOWNLOAD_WINDOWS: %v", err)
+	}
+
+	altSpeedWindows, err := coordinator.ParseTimeWindows(os.Getenv("ALT_SPEED_WINDOWS"))
+	if err != nil {
+		log.Fatalf("Failed to parse ALT_SPEED_WINDOWS: %v", err)
+	}
+
+	maxActiveDownloads := getEnvIntOrDefault("MAX_ACTIVE_DOWNLOADS", 0)
+	maxActivePerCategory := map[common.RequestType]int{
+		common.RequestType_FILMS:           getEnvIntOrDefault("MAX_ACTIVE_FILMS", 0),
+		common.RequestType_SERIES:          getEnvIntOrDefault("MAX_ACTIVE_SERIES", 0),
+		common.RequestType_CARTOONS:        getEnvIntOrDefault("MAX_ACTIVE_CARTOONS", 0),
+		common.RequestType_CARTOONS_SERIES: getEnvIntOrDefault("MAX_ACTIVE_CARTOONS_SERIES", 0),
+		common.RequestType_SHORTS:          getEnvIntOrDefault("MAX_ACTIVE_SHORTS", 0),
+	}
+
+	diskSpacePolicy, err := coordinator.ParseDiskSpacePolicy(os.Getenv("DISK_SPACE_POLICY"))
+	if err != nil {
+		log.Fatalf("Failed to parse DISK_SPACE_POLICY: %v", err)
+	}
+	minFreeSpaceBytes := int64(getEnvIntOrDefault("MIN_FREE_SPACE_GB", 0)) << 30
+
+	seedingRules, err := coordinator.ParseSeedingRules(os.Getenv("SEEDING_RULES"))
+	if err != nil {
+		log.Fatalf("Failed to parse SEEDING_RULES: %v", err)
+	}
+	removeAfterSeeding := os.Getenv("REMOVE_AFTER_SEEDING") == "true"
+
+	importMode, err := coordinator.ParseImportMode(os.Getenv("IMPORT_MODE"))
+	if err != nil {
+		log.Fatalf("Failed to parse IMPORT_MODE: %v", err)
+	}
+
+	pathMapping, err := paths.ParseMapping(os.Getenv("IMPORT_PATH_MAPPING"))
+	if err != nil {
+		log.Fatalf("Failed to parse IMPORT_PATH_MAPPING: %v", err)
+	}
+
+	extractArchives := os.Getenv("EXTRACT_ARCHIVES") == "true"
+	plexConfirmTimeout := getEnvDurationOrDefault("PLEX_CONFIRM_TIMEOUT", 2*time.Minute)
+
 	// Create Redis client
 	redisOptions := &redis.Options{
 		Addr: redisURL,
@@ -41,8 +96,11 @@ func main() {
 	}
 	redisClient := redis.NewClient(redisOptions)
 
+	// Background services stop on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Test Redis connection
-	ctx := context.Background()
 	if err := redisClient.Ping(ctx).Err(); err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
@@ -54,14 +112,31 @@ func main() {
 	}
 	defer transmissionConn.Close()
 
-	plexConn, err := grpc.NewClient(plexServiceURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("Failed to connect to Plex service: %v", err)
+	var plexConns []*grpc.ClientConn
+	for _, plexServiceURL := range plexServiceURLs {
+		plexConn, err := grpc.NewClient(strings.TrimSpace(plexServiceURL), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("Failed to connect to Plex service %s: %v", plexServiceURL, err)
+		}
+		defer plexConn.Close()
+		plexConns = append(plexConns, plexConn)
 	}
-	defer plexConn.Close()
 
 	// Create coordinator service
-	coordinatorService := coordinator.NewService(transmissionConn, plexConn, redisClient, pbTypeToDownloadPath)
+	coordinatorService := coordinator.NewService(transmissionConn, plexConns, redisClient, pbTypeToDownloadPath, coordinator.Options{
+		DownloadWindows:               downloadWindows,
+		AltSpeedWindows:               altSpeedWindows,
+		MaxActiveDownloads:            maxActiveDownloads,
+		MaxActiveDownloadsPerCategory: maxActivePerCategory,
+		MinFreeSpaceBytes:             minFreeSpaceBytes,
+		DiskSpacePolicy:               diskSpacePolicy,
+		SeedingRules:                  seedingRules,
+		RemoveAfterSeeding:            removeAfterSeeding,
+		ImportMode:                    importMode,
+		PathMapping:                   pathMapping,
+		ExtractArchives:               extractArchives,
+		PlexConfirmTimeout:            plexConfirmTimeout,
+	})
 
 	// Create gRPC server
 	grpcServer := grpc.NewServer()
@@ -75,10 +150,49 @@ func main() {
 	}
 
 	log.Println("Coordinator service is running on port " + servicePort)
-	go coordinatorService.StartProgressCheckerService(ctx)
+	coordinatorService.ResumeDirectDownloads(ctx)
+	coordinatorService.ResumeFinishing(ctx)
+
+	var services sync.WaitGroup
+	for _, service := range []func(context.Context){
+		coordinatorService.StartProgressCheckerService,
+		coordinatorService.StartSchedulerService,
+		coordinatorService.StartRecoveryService,
+	} {
+		services.Add(1)
+		go func() {
+			defer services.Done()
+			service(ctx)
+		}()
+	}
+
+	go func() {
+		<-ctx.Done()
+		log.Println("Shutting down coordinator service")
+		gracefulStop(grpcServer)
+	}()
+
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
+
+	services.Wait()
+	log.Println("Coordinator service stopped")
+}
+
+// gracefulStop lets running calls finish, streams such as WatchDownloads are cut after shutdownTimeout
+func gracefulStop(grpcServer *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		grpcServer.Stop()
+	}
 }
 
 func getEnvOrRaise(key string) string {
@@ -88,3 +202,29 @@ func getEnvOrRaise(key string) string {
 	}
 	return value
 }
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("Environment variable %s must be an integer: %v", key, err)
+	}
+	return parsed
+}
+
+func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Environment variable %s must be a duration, e.g. 2m: %v", key, err)
+	}
+	return parsed
+}
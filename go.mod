@@ -8,6 +8,7 @@ require (
 	github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
 	github.com/google/uuid v1.6.0
 	github.com/hekmon/transmissionrpc/v3 v3.0.0
+	github.com/nwaples/rardecode v1.1.3
 	github.com/redis/go-redis/v9 v9.7.3
 	google.golang.org/grpc v1.71.1
 	google.golang.org/protobuf v1.36.6
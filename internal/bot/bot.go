@@ -2,6 +2,7 @@ package bot
 
 import (
 	"log"
+	"strings"
 
 	coordinator "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -11,18 +12,24 @@ import (
 type Bot struct {
 	api            *tgbotapi.BotAPI
 	allowedUserIds map[int64]bool
+	adminUserIds   map[int64]bool
 	coordClient    coordinator.CoordinatorServiceClient
 	redisClient    *redis.Client
 	downloadFlow   *DownloadFlow
 	statusChecker  *StatusChecker
 	queueProcessor *QueueProcessor
+	showsHandler   *ShowsHandler
+	speedControls  *SpeedControls
+	torrentsView   *TorrentsView
 }
 
 func NewBot(
 	token string,
 	allowedUserIdsList []int64,
+	adminUserIdsList []int64,
 	coordClient coordinator.CoordinatorServiceClient,
 	redisClient *redis.Client,
+	watchDownloads bool,
 ) (*Bot, error) {
 	bot, err := tgbotapi.NewBotAPI(token)
 	if err != nil {
@@ -34,16 +41,25 @@ func NewBot(
 		allowedUserIds[userId] = true
 	}
 
+	adminUserIds := make(map[int64]bool)
+	for _, userId := range adminUserIdsList {
+		adminUserIds[userId] = true
+	}
+
 	b := &Bot{
 		api:            bot,
 		allowedUserIds: allowedUserIds,
+		adminUserIds:   adminUserIds,
 		coordClient:    coordClient,
 		redisClient:    redisClient,
 	}
 
 	b.downloadFlow = NewDownloadFlow(b)
 	b.statusChecker = NewStatusChecker(b)
-	b.queueProcessor = NewQueueProcessor(b)
+	b.queueProcessor = NewQueueProcessor(b, watchDownloads)
+	b.showsHandler = NewShowsHandler(b)
+	b.speedControls = NewSpeedControls(b)
+	b.torrentsView = NewTorrentsView(b)
 	return b, nil
 }
 
@@ -80,7 +96,7 @@ func (b *Bot) Start() {
 				continue
 			}
 
-			b.statusChecker.HandleCallback(update.CallbackQuery)
+			b.handleCallback(update.CallbackQuery)
 		}
 	}
 
@@ -95,11 +111,30 @@ func (b *Bot) handleCommand(msg *tgbotapi.Message) {
 	case "start":
 		response.Text = "🌟 Wow! Welcome to the Torrent Downloader Bot! I can help you download torrents effortlessly.\nJust send /help to discover all the amazing commands available!"
 	case "help":
-		response.Text = "🌟 Welcome to the Torrent Downloader Bot! Here are the magical commands you can use:\n/start - Kickstart your journey with the bot\n/download - Let’s dive into the world of torrents and download your favorites!\n/status - Keep track of your ongoing downloads and their progress\n/help - Need assistance? Just ask and I’ll guide you!"
+		response.Text = "🌟 Welcome to the Torrent Downloader Bot! Here are the magical commands you can use:\n/start - Kickstart your journey with the bot\n/download - Let’s dive into the world of torrents and download your favorites!\n/status - Keep track of your ongoing downloads and their progress\n/shows - Follow your favorite shows and spot missing episodes\n/disk - See how much space is left for each category\n/speed - Check and control download speed (admins)\n/torrents - Browse every torrent in Transmission and adopt untracked ones (admins)\n/help - Need assistance? Just ask and I’ll guide you!"
 	case "download":
 		b.downloadFlow.Start(msg.Chat.ID)
 	case "status":
 		b.statusChecker.CheckStatus(msg.Chat.ID, msg.MessageID)
+	case "shows":
+		b.showsHandler.HandleCommand(msg)
+		return
+	case "disk":
+		response.Text = b.diskUsageText()
+	case "speed":
+		if !b.isAdmin(msg.From.ID) {
+			response.Text = "⛔ This command is available to admins only"
+			break
+		}
+		b.speedControls.ShowSpeed(msg.Chat.ID)
+		return
+	case "torrents":
+		if !b.isAdmin(msg.From.ID) {
+			response.Text = "⛔ This command is available to admins only"
+			break
+		}
+		b.torrentsView.ShowTorrents(msg.Chat.ID)
+		return
 	default:
 		response.Text = "I don't know that command"
 	}
@@ -107,6 +142,33 @@ func (b *Bot) handleCommand(msg *tgbotapi.Message) {
 	b.api.Send(response)
 }
 
+func (b *Bot) handleCallback(callback *tgbotapi.CallbackQuery) {
+	if strings.HasPrefix(callback.Data, "speed_") {
+		if !b.isAdmin(callback.From.ID) {
+			b.api.Send(tgbotapi.NewCallback(callback.ID, "⛔ Admins only"))
+			return
+		}
+		b.speedControls.HandleCallback(callback)
+		return
+	}
+
+	if strings.HasPrefix(callback.Data, "torrents_") {
+		if !b.isAdmin(callback.From.ID) {
+			b.api.Send(tgbotapi.NewCallback(callback.ID, "⛔ Admins only"))
+			return
+		}
+		b.torrentsView.HandleCallback(callback)
+		return
+	}
+
+	b.statusChecker.HandleCallback(callback)
+}
+
+// isAdmin reports whether the user may run admin commands, nobody is an admin if no admins are configured
+func (b *Bot) isAdmin(userID int64) bool {
+	return b.adminUserIds[userID]
+}
+
 func (b *Bot) prehandleMessage(msg *tgbotapi.Message) tgbotapi.MessageConfig {
 	response := tgbotapi.NewMessage(msg.Chat.ID, "")
 	response.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
@@ -1,5 +1,13 @@
 package bot
 
+import coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+
+var priorityLevels = map[string]coordinatorpb.DownloadPriority{
+	"high":   coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_HIGH,
+	"normal": coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_NORMAL,
+	"low":    coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_LOW,
+}
+
 const (
 	filmsCategory          = "🎬 Films"
 	seriesCategory         = "📺 Series"
@@ -7,9 +15,19 @@ const (
 	cartoonsSeriesCategory = "🕸️ Cartoon Series"
 	cartoonsShortsCategory = "🩳 Cartoon Shorts"
 
+	highPriorityOption   = "🔺 High priority"
+	normalPriorityOption = "▪️ Normal priority"
+	lowPriorityOption    = "🔻 Low priority"
+
+	startNowOption     = "▶️ Start now"
+	startAtNightOption = "🌙 Start at night"
+
 	// Redis related
 	KeyTorrentInProgress     = "bot:torrents:%s"
 	KeyTorrentInProgressKeys = "bot:torrents:keys"
 	KeyTorrentDownloadOwner  = "bot:torrents:owner:%s"
-	KeyDownloadProgressQueue = "coordinator-bot:download:progress"
+	KeyDownloadEvents        = "coordinator-bot:download:events"
+	KeyPendingDownloads      = "coordinator-bot:downloads:pending"
+	KeyDownloadEventsDead    = "bot:download:events:dead"
+	KeyDownloadWatchCursor   = "bot:download:watch_cursor"
 )
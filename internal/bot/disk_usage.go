@@ -0,0 +1,48 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/internal/units"
+)
+
+var categoryNames = map[common.RequestType]string{
+	common.RequestType_FILMS:           filmsCategory,
+	common.RequestType_SERIES:          seriesCategory,
+	common.RequestType_CARTOONS:        cartoonsCategory,
+	common.RequestType_CARTOONS_SERIES: cartoonsSeriesCategory,
+	common.RequestType_SHORTS:          cartoonsShortsCategory,
+}
+
+func (b *Bot) diskUsageText() string {
+	resp, err := b.coordClient.GetDiskUsage(context.Background(), &coordinatorpb.GetDiskUsageRequest{})
+	if err != nil {
+		log.Printf("Failed to get disk usage: %v", err)
+		return "❌ Oops! I couldn't check the disk space. Please try again later!"
+	}
+
+	var sb strings.Builder
+	sb.WriteString("💾 Disk space:\n")
+	for _, dir := range resp.Directories {
+		sb.WriteString(fmt.Sprintf("\n%s (%s)\n", categoryNames[dir.Category], dir.Path))
+
+		switch {
+		case dir.Error != "":
+			sb.WriteString("❌ " + dir.Error + "\n")
+		case dir.TotalBytes > 0:
+			used := dir.TotalBytes - dir.FreeBytes
+			sb.WriteString(fmt.Sprintf("%s\n🟢 Free: %s, 🔴 Used: %s of %s\n",
+				createProgressBar(float64(used)*100/float64(dir.TotalBytes)),
+				units.FormatBytes(dir.FreeBytes), units.FormatBytes(used), units.FormatBytes(dir.TotalBytes)))
+		default:
+			sb.WriteString(fmt.Sprintf("🟢 Free: %s\n", units.FormatBytes(dir.FreeBytes)))
+		}
+	}
+
+	return sb.String()
+}
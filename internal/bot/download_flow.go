@@ -2,15 +2,21 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
 	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Step int
@@ -18,17 +24,34 @@ type Step int
 const (
 	StepWaitingForLink Step = iota + 1
 	StepWaitingForCategory
+	StepWaitingForPriority
+	StepWaitingForSchedule
 	StepDownloading
 )
 
+const (
+	// addDownloadAttempts and addDownloadRetryDelay bound the retries of a download request
+	addDownloadAttempts   = 3
+	addDownloadRetryDelay = 2 * time.Second
+)
+
 type downloadState struct {
-	step     Step
-	link     string
-	category common.RequestType
+	// requestID is kept for the whole flow, so that a repeated request doesn't add the download twice
+	requestID     string
+	step          Step
+	link          string
+	category      common.RequestType
+	priority      coordinatorpb.DownloadPriority
+	startAt       int64
+	startInWindow bool
+	// direct is set for plain HTTP(S) links that are downloaded without a torrent client
+	direct bool
 }
 
 type DownloadFlow struct {
-	bot    *Bot
+	bot *Bot
+	// mu guards States, downloads are requested from the coordinator in the background
+	mu     sync.Mutex
 	States map[int64]*downloadState
 }
 
@@ -40,15 +63,22 @@ func NewDownloadFlow(bot *Bot) *DownloadFlow {
 }
 
 func (df *DownloadFlow) Start(chatID int64) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
 	df.States[chatID] = &downloadState{
-		step: StepWaitingForLink,
+		requestID: uuid.New().String(),
+		step:      StepWaitingForLink,
 	}
 
-	response := tgbotapi.NewMessage(chatID, "✨ Awesome! Please send me a magnet link or torrent file to begin your download journey!")
+	response := tgbotapi.NewMessage(chatID, "✨ Awesome! Please send me a magnet link, torrent file or direct download link to begin your download journey!")
 	df.bot.api.Send(response)
 }
 
 func (df *DownloadFlow) HandleMessage(msg *tgbotapi.Message) {
+	df.mu.Lock()
+	defer df.mu.Unlock()
+
 	response := tgbotapi.NewMessage(msg.Chat.ID, "")
 
 	if state, exists := df.States[msg.Chat.ID]; exists {
@@ -57,6 +87,13 @@ func (df *DownloadFlow) HandleMessage(msg *tgbotapi.Message) {
 			df.handleWaitingForLinkStep(msg, state, response)
 		case StepWaitingForCategory:
 			df.handleWaitingForCategoryStep(msg, state, response)
+		case StepWaitingForPriority:
+			df.handleWaitingForPriorityStep(msg, state, response)
+		case StepWaitingForSchedule:
+			df.handleWaitingForScheduleStep(msg, state, response)
+		case StepDownloading:
+			response.Text = "⏳ I'm still starting your download, hang on!"
+			df.bot.api.Send(response)
 		}
 	} else {
 		response.Text = "Please use /download command to start a new download"
@@ -73,6 +110,15 @@ func (df *DownloadFlow) handleWaitingForLinkStep(msg *tgbotapi.Message, state *d
 		return
 	}
 
+	// Check if it's a direct link, links to torrent files still go to the torrent client
+	if link, err := url.Parse(strings.TrimSpace(msg.Text)); err == nil && (link.Scheme == "http" || link.Scheme == "https") && link.Host != "" {
+		state.link = link.String()
+		state.direct = !strings.HasSuffix(strings.ToLower(link.Path), ".torrent")
+		state.step = StepWaitingForCategory
+		df.sendCategoryButtons(msg.Chat.ID)
+		return
+	}
+
 	// Check if it's a document (torrent file)
 	if msg.Document != nil && strings.HasSuffix(msg.Document.FileName, ".torrent") {
 		// Get file info
@@ -94,7 +140,7 @@ func (df *DownloadFlow) handleWaitingForLinkStep(msg *tgbotapi.Message, state *d
 	}
 
 	// Invalid input
-	response.Text = "❌ Please send a valid magnet link or torrent file. I'm here to help you download your content!"
+	response.Text = "❌ Please send a valid magnet link, torrent file or HTTP(S) link. I'm here to help you download your content!"
 	delete(df.States, msg.Chat.ID)
 	df.bot.api.Send(response)
 }
@@ -119,50 +165,204 @@ func (df *DownloadFlow) handleWaitingForCategoryStep(msg *tgbotapi.Message, stat
 	}
 
 	state.category = category
+	state.step = StepWaitingForPriority
+	df.sendPriorityButtons(msg.Chat.ID)
+}
+
+func (df *DownloadFlow) handleWaitingForPriorityStep(msg *tgbotapi.Message, state *downloadState, response tgbotapi.MessageConfig) {
+	switch msg.Text {
+	case highPriorityOption:
+		state.priority = coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_HIGH
+	case normalPriorityOption:
+		state.priority = coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_NORMAL
+	case lowPriorityOption:
+		state.priority = coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_LOW
+	default:
+		response.Text = "❌ Please select a priority from the options below"
+		df.bot.api.Send(response)
+		return
+	}
+
+	// Direct downloads start right away
+	if state.direct {
+		df.startDownload(msg, state, response)
+		return
+	}
+
+	state.step = StepWaitingForSchedule
+	df.sendScheduleButtons(msg.Chat.ID)
+}
+
+func (df *DownloadFlow) handleWaitingForScheduleStep(msg *tgbotapi.Message, state *downloadState, response tgbotapi.MessageConfig) {
+	switch msg.Text {
+	case startNowOption:
+	case startAtNightOption:
+		state.startInWindow = true
+	default:
+		startAt, err := parseStartTime(msg.Text, time.Now())
+		if err != nil {
+			response.Text = "❌ Please pick an option below or send a start time like 23:30"
+			df.bot.api.Send(response)
+			return
+		}
+		state.startAt = startAt.Unix()
+	}
+
+	df.startDownload(msg, state, response)
+}
+
+// startDownload requests the download in the background, so that retries while the coordinator is
+// unavailable don't hold up the messages of other chats. The caller holds mu.
+func (df *DownloadFlow) startDownload(msg *tgbotapi.Message, state *downloadState, response tgbotapi.MessageConfig) {
 	state.step = StepDownloading
 
-	// Start the download
-	resp, err := df.bot.coordClient.AddTorrentByMagnet(context.Background(), &coordinatorpb.AddTorrentByMagnetRequest{
-		RequestId:  uuid.New().String(),
-		MagnetLink: state.link,
-		Category:   state.category,
-	})
+	go func() {
+		resp, err := df.addDownload(msg.Chat.ID, state)
+
+		df.mu.Lock()
+		defer df.mu.Unlock()
+		df.handleDownloadStarted(msg, state, response, resp, err)
+	}()
+}
+
+// handleDownloadStarted tells the user how the download request went, the caller holds mu
+func (df *DownloadFlow) handleDownloadStarted(msg *tgbotapi.Message, state *downloadState, response tgbotapi.MessageConfig, resp *coordinatorpb.DownloadResponse, err error) {
+	if status.Code(err) == codes.InvalidArgument && state.direct {
+		log.Printf("Direct download refused: %v", err)
+		response.Text = "❌ I couldn't download that link: " + status.Convert(err).Message()
+		df.endFlow(msg.Chat.ID, state)
+		response.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		df.bot.api.Send(response)
+		return
+	}
+
+	if status.Code(err) == codes.AlreadyExists {
+		log.Printf("Download skipped: %v", err)
+		response.Text = "🔁 Looks like you already have these episodes! " + status.Convert(err).Message()
+		df.endFlow(msg.Chat.ID, state)
+		response.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		df.bot.api.Send(response)
+		return
+	}
+
+	if status.Code(err) == codes.FailedPrecondition && state.startInWindow {
+		log.Printf("Download schedule refused: %v", err)
+		response.Text = "🕒 I can't start it at night: " + status.Convert(err).Message()
+		df.bot.api.Send(response)
+
+		// Let the user pick another start, unless they already started a new download
+		if df.States[msg.Chat.ID] != state {
+			return
+		}
+		state.step = StepWaitingForSchedule
+		state.startInWindow = false
+		df.sendScheduleButtons(msg.Chat.ID)
+		return
+	}
+
+	if status.Code(err) == codes.ResourceExhausted {
+		log.Printf("Download refused: %v", err)
+		response.Text = "💾 Not enough disk space for a new download: " + status.Convert(err).Message()
+		df.endFlow(msg.Chat.ID, state)
+		response.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
+		df.bot.api.Send(response)
+		return
+	}
 
 	if err != nil {
 		log.Printf("Failed to start download: %v", err)
 		response.Text = "❌ Oops! I couldn't start the download. Please try again later!"
-		delete(df.States, msg.Chat.ID)
+		df.endFlow(msg.Chat.ID, state)
 		df.bot.api.Send(response)
 		return
 	}
 
-	status := &DownloadStatus{
-		Name:     resp.Name,
-		Status:   resp.Status,
-		Message:  resp.Message,
-		ETA:      time.Duration(resp.Eta) * time.Second,
-		Progress: resp.Progress,
-	}
-
-	err1 := df.bot.redisClient.HSet(context.Background(), fmt.Sprintf(KeyTorrentInProgress, resp.RequestId), status.ToRedisMap()).Err()
-	err2 := df.bot.redisClient.SAdd(context.Background(), KeyTorrentInProgressKeys, resp.RequestId).Err()
-	err3 := df.bot.redisClient.Set(context.Background(), fmt.Sprintf(KeyTorrentDownloadOwner, resp.RequestId), msg.Chat.ID, 24*time.Hour).Err()
-	if err1 != nil || err2 != nil || err3 != nil {
-		log.Printf("Failed to set status in Redis: \ndetails: %v, \nkeys: %v, \nowner: %v", err1, err2, err3)
+	if err := df.bot.trackDownload(msg.Chat.ID, resp); err != nil {
 		response.Text = "⚠️ Download started, but I couldn't save the status locally. You can check the status using /status command"
-		delete(df.States, msg.Chat.ID)
+		df.endFlow(msg.Chat.ID, state)
 		df.bot.api.Send(response)
 		return
 	}
 
 	response.Text = "✅ Download started!\n📁 Torrent name: " + resp.Name
-	delete(df.States, msg.Chat.ID)
+	if state.direct {
+		response.Text = "✅ Download started!\n📁 File name: " + resp.Name
+	}
+	switch resp.Status {
+	case coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SCHEDULED:
+		response.Text = "🕒 Download scheduled!\n📁 Torrent name: " + resp.Name + "\n💬 " + resp.Message
+	case coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_QUEUED:
+		response.Text = "📋 Download queued!\n📁 Torrent name: " + resp.Name + "\n💬 " + resp.Message + "\nUse /status to change its priority"
+	}
+	df.endFlow(msg.Chat.ID, state)
 
 	// Remove the keyboard
 	response.ReplyMarkup = tgbotapi.NewRemoveKeyboard(true)
 	df.bot.api.Send(response)
 }
 
+// endFlow forgets the download flow of a chat, unless the user already started a new one
+func (df *DownloadFlow) endFlow(chatID int64, state *downloadState) {
+	if df.States[chatID] == state {
+		delete(df.States, chatID)
+	}
+}
+
+// trackDownload saves a started download so that its progress updates reach the chat
+func (b *Bot) trackDownload(chatID int64, resp *coordinatorpb.DownloadResponse) error {
+	downloadStatus := NewDownloadStatus(resp)
+
+	err1 := b.redisClient.HSet(context.Background(), fmt.Sprintf(KeyTorrentInProgress, resp.RequestId), downloadStatus.ToRedisMap()).Err()
+	err2 := b.redisClient.SAdd(context.Background(), KeyTorrentInProgressKeys, resp.RequestId).Err()
+	if err2 == nil {
+		// Lets the coordinator send the final update again if it gets lost
+		err2 = b.redisClient.SAdd(context.Background(), KeyPendingDownloads, resp.RequestId).Err()
+	}
+	err3 := b.redisClient.Set(context.Background(), fmt.Sprintf(KeyTorrentDownloadOwner, resp.RequestId), chatID, 0).Err()
+	if err1 != nil || err2 != nil || err3 != nil {
+		log.Printf("Failed to set status in Redis: \ndetails: %v, \nkeys: %v, \nowner: %v", err1, err2, err3)
+		return errors.New("failed to save download status")
+	}
+
+	return nil
+}
+
+// addDownload asks the coordinator for the download, retrying with the same request ID while it is unavailable
+func (df *DownloadFlow) addDownload(chatID int64, state *downloadState) (*coordinatorpb.DownloadResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := df.requestDownload(chatID, state)
+		if status.Code(err) != codes.Unavailable || attempt == addDownloadAttempts {
+			return resp, err
+		}
+
+		log.Printf("Coordinator unavailable, retrying the download (requestID: %s): %v", state.requestID, err)
+		time.Sleep(addDownloadRetryDelay)
+	}
+}
+
+func (df *DownloadFlow) requestDownload(chatID int64, state *downloadState) (*coordinatorpb.DownloadResponse, error) {
+	requester := strconv.FormatInt(chatID, 10)
+	if state.direct {
+		return df.bot.coordClient.AddDownloadByURL(context.Background(), &coordinatorpb.AddDownloadByURLRequest{
+			RequestId: state.requestID,
+			Url:       state.link,
+			Category:  state.category,
+			Requester: requester,
+			Priority:  state.priority,
+		})
+	}
+
+	return df.bot.coordClient.AddTorrentByMagnet(context.Background(), &coordinatorpb.AddTorrentByMagnetRequest{
+		RequestId:     state.requestID,
+		MagnetLink:    state.link,
+		Category:      state.category,
+		StartAt:       state.startAt,
+		StartInWindow: state.startInWindow,
+		Priority:      state.priority,
+		Requester:     requester,
+	})
+}
+
 func (df *DownloadFlow) sendCategoryButtons(chatID int64) {
 	keyboard := tgbotapi.NewReplyKeyboard(
 		tgbotapi.NewKeyboardButtonRow(
@@ -182,3 +382,45 @@ func (df *DownloadFlow) sendCategoryButtons(chatID int64) {
 	msg.ReplyMarkup = keyboard
 	df.bot.api.Send(msg)
 }
+
+func (df *DownloadFlow) sendPriorityButtons(chatID int64) {
+	keyboard := tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(highPriorityOption),
+			tgbotapi.NewKeyboardButton(normalPriorityOption),
+			tgbotapi.NewKeyboardButton(lowPriorityOption),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, "🚦 How urgent is it? High priority downloads skip ahead in the queue")
+	msg.ReplyMarkup = keyboard
+	df.bot.api.Send(msg)
+}
+
+func (df *DownloadFlow) sendScheduleButtons(chatID int64) {
+	keyboard := tgbotapi.NewReplyKeyboard(
+		tgbotapi.NewKeyboardButtonRow(
+			tgbotapi.NewKeyboardButton(startNowOption),
+			tgbotapi.NewKeyboardButton(startAtNightOption),
+		),
+	)
+
+	msg := tgbotapi.NewMessage(chatID, "⏰ When should I start the download? You can also send a time like 23:30")
+	msg.ReplyMarkup = keyboard
+	df.bot.api.Send(msg)
+}
+
+// parseStartTime returns the next occurrence of an HH:MM time after now
+func parseStartTime(text string, now time.Time) (time.Time, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(text))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	startAt := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !startAt.After(now) {
+		startAt = startAt.AddDate(0, 0, 1)
+	}
+
+	return startAt, nil
+}
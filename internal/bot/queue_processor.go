@@ -2,10 +2,13 @@ package bot
 
 import (
 	"context"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
@@ -14,18 +17,39 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+const (
+	// downloadEventsGroup is the consumer group the bot reads the progress stream with
+	downloadEventsGroup = "bot"
+	// pendingIdle is how long an unacknowledged update waits before it is handled again,
+	// e.g. after a failed notification or a crash
+	pendingIdle = time.Minute
+	// eventsBatchSize is the number of progress updates read from the stream at once
+	eventsBatchSize = 100
+)
+
 type QueueProcessor struct {
 	bot         *Bot
 	stopChan    chan struct{}
 	isRunning   bool
 	updateDelay time.Duration
+	// consumer names this bot in the consumer group, pending updates of other consumers are reclaimed
+	consumer string
+	// watch streams updates with WatchDownloads instead of reading the Redis stream
+	watch bool
 }
 
-func NewQueueProcessor(bot *Bot) *QueueProcessor {
+func NewQueueProcessor(bot *Bot, watch bool) *QueueProcessor {
+	consumer, err := os.Hostname()
+	if err != nil || consumer == "" {
+		consumer = downloadEventsGroup
+	}
+
 	return &QueueProcessor{
 		bot:         bot,
 		stopChan:    make(chan struct{}),
-		updateDelay: 30 * time.Second, // Update status every 5 seconds
+		updateDelay: 30 * time.Second, // Longest wait for new updates, and delay before retrying after errors
+		consumer:    consumer,
+		watch:       watch,
 	}
 }
 
@@ -35,7 +59,18 @@ func (qp *QueueProcessor) Start() {
 	}
 
 	qp.isRunning = true
-	go qp.processQueue()
+
+	// Downloads tracked before the pending set was shared with the coordinator
+	err := qp.bot.redisClient.SUnionStore(context.Background(), KeyPendingDownloads, KeyPendingDownloads, KeyTorrentInProgressKeys).Err()
+	if err != nil {
+		log.Printf("Failed to register active downloads with the coordinator: %v", err)
+	}
+
+	if qp.watch {
+		go qp.watchDownloads()
+	} else {
+		go qp.processQueue()
+	}
 }
 
 func (qp *QueueProcessor) Stop() {
@@ -47,104 +82,327 @@ func (qp *QueueProcessor) Stop() {
 	qp.isRunning = false
 }
 
+// stopContext returns a context that is cancelled when the processor stops
+func (qp *QueueProcessor) stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-qp.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// wait pauses before a retry, it returns false if the processor stopped meanwhile
+func (qp *QueueProcessor) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(qp.updateDelay):
+		return true
+	}
+}
+
+// processQueue reads progress updates through the bot's consumer group,
+// an update is acknowledged only once it is handled
 func (qp *QueueProcessor) processQueue() {
-	ctx := context.Background()
-	ticker := time.NewTicker(qp.updateDelay)
-	defer ticker.Stop()
+	ctx, cancel := qp.stopContext()
+	defer cancel()
 
 	for {
-		select {
-		case <-qp.stopChan:
+		err := qp.createGroup(ctx)
+		if err == nil {
+			break
+		}
+
+		log.Printf("Failed to create consumer group, retrying in %s: %v", qp.updateDelay, err)
+		if !qp.wait(ctx) {
 			return
-		case <-ticker.C:
-			qp.processMessages(ctx)
 		}
 	}
-}
 
-func (qp *QueueProcessor) processMessages(ctx context.Context) {
-	// Process messages one by one until the queue is empty
+	var reclaimedAt time.Time
 	for {
-		// Get one message from the queue
-		message, err := qp.bot.redisClient.LPop(ctx, KeyDownloadProgressQueue).Result()
+		if time.Since(reclaimedAt) >= pendingIdle {
+			qp.reclaimPending(ctx)
+			reclaimedAt = time.Now()
+		}
 
+		streams, err := qp.bot.redisClient.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    downloadEventsGroup,
+			Consumer: qp.consumer,
+			Streams:  []string{KeyDownloadEvents, ">"},
+			Count:    eventsBatchSize,
+			Block:    qp.updateDelay,
+		}).Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
 		if err != nil {
-			if err == redis.Nil {
-				// Queue is empty
+			log.Printf("Failed to read progress updates, retrying in %s: %v", qp.updateDelay, err)
+			if strings.HasPrefix(err.Error(), "NOGROUP") {
+				// The stream was deleted
+				if err := qp.createGroup(ctx); err != nil {
+					log.Printf("Failed to create consumer group: %v", err)
+				}
+			}
+			if !qp.wait(ctx) {
 				return
 			}
-			log.Printf("Failed to get message from queue: %v", err)
+			continue
+		}
+
+		for _, message := range streams[0].Messages {
+			qp.processMessage(ctx, message)
+		}
+	}
+}
+
+// createGroup creates the bot's consumer group. It starts with every kept update, so that updates added
+// before the group existed, e.g. while the stream was recreated, are not skipped; updates of downloads
+// the bot no longer waits for are dropped by handleUpdate.
+func (qp *QueueProcessor) createGroup(ctx context.Context) error {
+	err := qp.bot.redisClient.XGroupCreateMkStream(ctx, KeyDownloadEvents, downloadEventsGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// reclaimPending handles again the updates that were delivered but not acknowledged for pendingIdle,
+// to this bot or to a crashed one
+func (qp *QueueProcessor) reclaimPending(ctx context.Context) {
+	start := "0-0"
+	for {
+		messages, next, err := qp.bot.redisClient.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   KeyDownloadEvents,
+			Group:    downloadEventsGroup,
+			Consumer: qp.consumer,
+			MinIdle:  pendingIdle,
+			Start:    start,
+			Count:    eventsBatchSize,
+		}).Result()
+		if err != nil {
+			log.Printf("Failed to reclaim pending progress updates: %v", err)
 			return
 		}
 
-		encodedMessage := base64.StdEncoding.EncodeToString([]byte(message))
-		log.Printf("Message from queue: %s", encodedMessage)
+		for _, message := range messages {
+			log.Printf("Retrying progress update %s", message.ID)
+			qp.processMessage(ctx, message)
+		}
 
-		var downloadResp coordinatorpb.DownloadResponse
-		if err := proto.Unmarshal([]byte(message), &downloadResp); err != nil {
-			log.Printf("Failed to unmarshal message: %v", err)
-			continue
+		if next == "0-0" {
+			return
 		}
+		start = next
+	}
+}
+
+// processMessage handles a progress update and acknowledges it, failed updates stay pending
+func (qp *QueueProcessor) processMessage(ctx context.Context, message redis.XMessage) {
+	downloadResp, err := decodeDownloadEvent(message)
+	if err != nil {
+		// Retrying won't help, keep the update aside for inspection
+		log.Printf("Failed to decode progress update %s, moving it to %s: %v", message.ID, KeyDownloadEventsDead, err)
 
-		// Convert to DownloadStatus
-		status := &DownloadStatus{
-			Name:     downloadResp.Name,
-			Status:   downloadResp.Status,
-			Message:  downloadResp.Message,
-			ETA:      time.Duration(downloadResp.Eta) * time.Second,
-			Progress: downloadResp.Progress,
+		values := map[string]any{"id": message.ID}
+		for field, value := range message.Values {
+			values[field] = value
 		}
+		if err := qp.bot.redisClient.XAdd(ctx, &redis.XAddArgs{Stream: KeyDownloadEventsDead, Values: values}).Err(); err != nil {
+			log.Printf("Failed to save undecodable progress update %s: %v", message.ID, err)
+			return
+		}
+	} else if err := qp.handleUpdate(ctx, downloadResp); err != nil {
+		log.Printf("Failed to handle progress update %s, retrying in %s: %v", message.ID, pendingIdle, err)
+		return
+	}
 
-		log.Printf("Download status: %s", status.ToLogString())
+	if err := qp.bot.redisClient.XAck(ctx, KeyDownloadEvents, downloadEventsGroup, message.ID).Err(); err != nil {
+		log.Printf("Failed to acknowledge progress update %s: %v", message.ID, err)
+	}
+}
 
-		// Update status in Redis
-		key := fmt.Sprintf(KeyTorrentInProgress, downloadResp.RequestId)
-		err = qp.bot.redisClient.HSet(ctx, key, status.ToRedisMap()).Err()
-		if err != nil {
-			log.Printf("Failed to update status in Redis: %v", err)
-			continue
+func decodeDownloadEvent(message redis.XMessage) (*coordinatorpb.DownloadResponse, error) {
+	data, ok := message.Values["data"].(string)
+	if !ok {
+		return nil, errors.New("missing data field")
+	}
+
+	downloadResp := &coordinatorpb.DownloadResponse{}
+	if err := proto.Unmarshal([]byte(data), downloadResp); err != nil {
+		return nil, err
+	}
+	return downloadResp, nil
+}
+
+// watchDownloads receives progress updates from the coordinator's WatchDownloads stream,
+// reconnecting from the last handled update
+func (qp *QueueProcessor) watchDownloads() {
+	ctx, cancel := qp.stopContext()
+	defer cancel()
+
+	for {
+		err := qp.receiveUpdates(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Download watch interrupted, reconnecting in %s: %v", qp.updateDelay, err)
+		if !qp.wait(ctx) {
+			return
 		}
+	}
+}
 
-		// Add to set of active downloads if not already present
-		err = qp.bot.redisClient.SAdd(ctx, KeyTorrentInProgressKeys, downloadResp.RequestId).Err()
+func (qp *QueueProcessor) receiveUpdates(ctx context.Context) error {
+	cursor, err := qp.bot.redisClient.Get(ctx, KeyDownloadWatchCursor).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get watch cursor: %w", err)
+	}
+
+	stream, err := qp.bot.coordClient.WatchDownloads(ctx, &coordinatorpb.WatchDownloadsRequest{Cursor: cursor})
+	if err != nil {
+		return err
+	}
+	log.Printf("Watching downloads (cursor: %s)", cursor)
+
+	for {
+		event, err := stream.Recv()
 		if err != nil {
-			log.Printf("Failed to add to active downloads set: %v", err)
-			continue
+			return err
 		}
 
-		// If download is completed or failed, remove from active downloads
-		if status.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS || status.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR {
-			err := qp.bot.redisClient.SRem(ctx, KeyTorrentInProgressKeys, downloadResp.RequestId).Err()
-			if err != nil {
-				log.Printf("Failed to remove from active downloads set: %v", err)
-				continue
-			}
+		// The cursor only moves past handled updates, a failed one is received again after reconnecting
+		if err := qp.handleUpdate(ctx, event.Download); err != nil {
+			return fmt.Errorf("failed to handle progress update %s: %w", event.Cursor, err)
+		}
 
-			err = qp.bot.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentInProgress, downloadResp.RequestId)).Err()
-			if err != nil {
-				log.Printf("Failed to remove from active downloads set: %v", err)
-			}
+		if err := qp.bot.redisClient.Set(ctx, KeyDownloadWatchCursor, event.Cursor, 0).Err(); err != nil {
+			log.Printf("Failed to save watch cursor: %v", err)
+		}
+	}
+}
 
-			ownerResp := qp.bot.redisClient.GetDel(ctx, fmt.Sprintf(KeyTorrentDownloadOwner, downloadResp.RequestId))
-			if ownerResp.Err() != nil {
-				log.Printf("Failed to get download owner: %v", ownerResp.Err())
-				continue
-			}
+// handleUpdate saves a progress update and notifies the owner of the download.
+// Notifications go first, so that a failed one is sent again when the update is retried.
+func (qp *QueueProcessor) handleUpdate(ctx context.Context, downloadResp *coordinatorpb.DownloadResponse) error {
+	// Convert to DownloadStatus
+	status := NewDownloadStatus(downloadResp)
 
-			ownerID := ownerResp.Val()
-			if ownerID == "" {
-				log.Printf("Download owner not found for request ID: %s", downloadResp.RequestId)
-				continue
-			}
+	log.Printf("Download status: %s", status.ToLogString())
 
-			ownerIDInt, err := strconv.ParseInt(ownerID, 10, 64)
-			if err != nil {
-				log.Printf("Failed to convert ownerID to int64: %v", err)
-				continue
-			}
+	if status.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS || status.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR {
+		return qp.handleFinalUpdate(ctx, downloadResp, status)
+	}
+
+	// Downloads leave the set with their final update, a late or retried update must not bring them back
+	tracked, err := qp.bot.redisClient.SIsMember(ctx, KeyTorrentInProgressKeys, downloadResp.RequestId).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check active downloads set: %w", err)
+	}
+	if !tracked {
+		log.Printf("Dropping progress update of a download that is no longer active (requestID: %s)", downloadResp.RequestId)
+		return nil
+	}
+
+	key := fmt.Sprintf(KeyTorrentInProgress, downloadResp.RequestId)
+	previousStatus, err := qp.bot.redisClient.HGet(ctx, key, "status").Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to get status from Redis: %w", err)
+	}
+
+	// Let the owner know when the download changes state, e.g. a queued download has started,
+	// other messages such as extraction progress are only shown by /status
+	previous := coordinatorpb.DownloadStatus(coordinatorpb.DownloadStatus_value[previousStatus])
+	if previousStatus != "" && status.Message != "" && runningStatus(status.Status) != runningStatus(previous) {
+		if err := qp.notifyOwner(ctx, downloadResp, "🔔 "+status.Name+"\n📝 "+status.Message); err != nil {
+			return err
+		}
+	}
+
+	// Update status in Redis
+	if err := qp.bot.redisClient.HSet(ctx, key, status.ToRedisMap()).Err(); err != nil {
+		return fmt.Errorf("failed to update status in Redis: %w", err)
+	}
 
-			msg := tgbotapi.NewMessage(ownerIDInt, "🎉 Your download is complete!\n📁 File: "+status.Name+"\n📝 Message: "+status.Message+"\n\nIf you encountered any issues, feel free to reach out for help!")
-			qp.bot.api.Send(msg)
+	return nil
+}
+
+// runningStatus treats plain progress updates, which have no status, as in progress
+func runningStatus(status coordinatorpb.DownloadStatus) coordinatorpb.DownloadStatus {
+	if status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_UNSPECIFIED {
+		return coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_IN_PROGRESS
+	}
+	return status
+}
+
+// handleFinalUpdate notifies the owner of a completed or failed download, then forgets the download
+func (qp *QueueProcessor) handleFinalUpdate(ctx context.Context, downloadResp *coordinatorpb.DownloadResponse, status *DownloadStatus) error {
+	requestID := downloadResp.RequestId
+
+	// Downloads that already left the set were notified, the cleanup is being retried
+	tracked, err := qp.bot.redisClient.SIsMember(ctx, KeyTorrentInProgressKeys, requestID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check active downloads set: %w", err)
+	}
+	if tracked {
+		text := "🎉 Your download is complete!\n📁 File: " + status.Name + "\n📝 Message: " + status.Message + status.TransferDetails() + "\n\nIf you encountered any issues, feel free to reach out for help!"
+		if err := qp.notifyOwner(ctx, downloadResp, text); err != nil {
+			return err
 		}
 	}
+
+	// The set goes first, so that a retried cleanup doesn't notify again
+	if err := qp.bot.redisClient.SRem(ctx, KeyTorrentInProgressKeys, requestID).Err(); err != nil {
+		return fmt.Errorf("failed to remove from active downloads set: %w", err)
+	}
+
+	if err := qp.bot.redisClient.SRem(ctx, KeyPendingDownloads, requestID).Err(); err != nil {
+		return fmt.Errorf("failed to remove from pending downloads set: %w", err)
+	}
+
+	if err := qp.bot.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentDownloadOwner, requestID)).Err(); err != nil {
+		return fmt.Errorf("failed to remove download owner: %w", err)
+	}
+
+	if err := qp.bot.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentInProgress, requestID)).Err(); err != nil {
+		return fmt.Errorf("failed to remove download status: %w", err)
+	}
+
+	return nil
+}
+
+// notifyOwner sends a message to the owner of a download, falling back to the chat that asked the
+// coordinator for it. Downloads without a known owner are skipped.
+func (qp *QueueProcessor) notifyOwner(ctx context.Context, downloadResp *coordinatorpb.DownloadResponse, text string) error {
+	requestID := downloadResp.RequestId
+	ownerID, err := qp.bot.redisClient.Get(ctx, fmt.Sprintf(KeyTorrentDownloadOwner, requestID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		ownerID, err = strconv.ParseInt(downloadResp.Requester, 10, 64)
+		if err != nil {
+			log.Printf("Download owner not found for request ID: %s", requestID)
+			return nil
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get download owner: %w", err)
+	}
+
+	if _, err := qp.bot.api.Send(tgbotapi.NewMessage(ownerID, text)); err != nil {
+		// Blocked bots and deleted chats won't accept the message on retry either
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && (apiErr.Code == http.StatusBadRequest || apiErr.Code == http.StatusForbidden) {
+			log.Printf("Telegram refused the notification (requestID: %s): %v", requestID, err)
+			return nil
+		}
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
 }
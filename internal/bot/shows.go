@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const showsUsage = "📺 Watchlist commands:\n/shows - List watched shows\n/shows add <title> - Start tracking a show\n/shows remove <title> - Stop tracking a show"
+
+type ShowsHandler struct {
+	bot *Bot
+}
+
+func NewShowsHandler(bot *Bot) *ShowsHandler {
+	return &ShowsHandler{
+		bot: bot,
+	}
+}
+
+func (sh *ShowsHandler) HandleCommand(msg *tgbotapi.Message) {
+	response := tgbotapi.NewMessage(msg.Chat.ID, "")
+	args := strings.TrimSpace(msg.CommandArguments())
+	action, title, _ := strings.Cut(args, " ")
+	title = strings.TrimSpace(title)
+
+	switch {
+	case args == "":
+		response.Text = sh.listShows()
+	case action == "add" && title != "":
+		response.Text = sh.addShow(title)
+	case action == "remove" && title != "":
+		response.Text = sh.removeShow(title)
+	default:
+		response.Text = showsUsage
+	}
+
+	sh.bot.api.Send(response)
+}
+
+func (sh *ShowsHandler) listShows() string {
+	resp, err := sh.bot.coordClient.ListShows(context.Background(), &coordinatorpb.ListShowsRequest{})
+	if err != nil {
+		log.Printf("Failed to list shows: %v", err)
+		return "❌ Oops! I couldn't get the watchlist. Please try again later!"
+	}
+
+	if len(resp.Shows) == 0 {
+		return "📭 No shows in the watchlist yet.\n\n" + showsUsage
+	}
+
+	var sb strings.Builder
+	sb.WriteString("📺 Watched shows:\n")
+	for _, show := range resp.Shows {
+		sb.WriteString(formatShow(show))
+	}
+
+	return sb.String()
+}
+
+func (sh *ShowsHandler) addShow(title string) string {
+	show, err := sh.bot.coordClient.AddShow(context.Background(), &coordinatorpb.AddShowRequest{Title: title})
+	if err != nil {
+		log.Printf("Failed to add show: %v", err)
+		return "❌ Oops! I couldn't add the show. Please try again later!"
+	}
+
+	return "✅ Show added to the watchlist!\n" + formatShow(show)
+}
+
+func (sh *ShowsHandler) removeShow(title string) string {
+	resp, err := sh.bot.coordClient.RemoveShow(context.Background(), &coordinatorpb.RemoveShowRequest{Title: title})
+	if err != nil {
+		log.Printf("Failed to remove show: %v", err)
+		return "❌ Oops! I couldn't remove the show. Please try again later!"
+	}
+
+	if !resp.Removed {
+		return "🤷 This show is not in the watchlist"
+	}
+
+	return "🗑️ Show removed from the watchlist"
+}
+
+func formatShow(show *coordinatorpb.Show) string {
+	text := fmt.Sprintf("\n📁 %s\n✅ Downloaded: %s\n", show.Title, formatEpisodeRanges(show.Downloaded))
+	if len(show.Missing) > 0 {
+		text += fmt.Sprintf("⚠️ Missing: %s\n", formatEpisodeRanges(show.Missing))
+	}
+	return text
+}
+
+// formatEpisodeRanges renders sorted episodes compactly, e.g. "S01E01-E05, S01E07, S02E01"
+func formatEpisodeRanges(episodes []*coordinatorpb.Episode) string {
+	if len(episodes) == 0 {
+		return "none"
+	}
+
+	var parts []string
+	for i := 0; i < len(episodes); {
+		first := episodes[i]
+		j := i
+		for j+1 < len(episodes) && episodes[j+1].Season == first.Season && episodes[j+1].Episode == episodes[j].Episode+1 {
+			j++
+		}
+
+		part := fmt.Sprintf("S%02dE%02d", first.Season, first.Episode)
+		if j > i {
+			part += fmt.Sprintf("-E%02d", episodes[j].Episode)
+		}
+		parts = append(parts, part)
+		i = j + 1
+	}
+
+	return strings.Join(parts, ", ")
+}
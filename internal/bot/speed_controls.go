@@ -0,0 +1,167 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// speedPreset is a pair of global download/upload limits in KB/s, zero means unlimited
+type speedPreset struct {
+	Label string
+	Down  int64
+	Up    int64
+}
+
+var speedPresets = []speedPreset{
+	{Label: "♾️ Unlimited"},
+	{Label: "🐌 1 MB/s", Down: 1024, Up: 256},
+	{Label: "🚶 5 MB/s", Down: 5 * 1024, Up: 1024},
+	{Label: "🏃 10 MB/s", Down: 10 * 1024, Up: 2 * 1024},
+}
+
+type SpeedControls struct {
+	bot *Bot
+}
+
+func NewSpeedControls(bot *Bot) *SpeedControls {
+	return &SpeedControls{
+		bot: bot,
+	}
+}
+
+func (sc *SpeedControls) ShowSpeed(chatID int64) {
+	settings, err := sc.bot.coordClient.GetSpeed(context.Background(), &coordinatorpb.GetSpeedRequest{})
+	if err != nil {
+		log.Printf("Failed to get speed settings: %v", err)
+		sc.bot.api.Send(tgbotapi.NewMessage(chatID, "❌ Oops! I couldn't get the speed settings. Please try again later!"))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, formatSpeedSettings(settings))
+	msg.ReplyMarkup = speedKeyboard(settings)
+	sc.bot.api.Send(msg)
+}
+
+func (sc *SpeedControls) HandleCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+	action := strings.TrimPrefix(callback.Data, "speed_")
+
+	if action == "close" {
+		sc.bot.api.Send(tgbotapi.NewDeleteMessage(chatID, messageID))
+		return
+	}
+
+	var settings *coordinatorpb.SpeedSettings
+	var err error
+
+	switch {
+	case action == "refresh":
+		settings, err = sc.bot.coordClient.GetSpeed(context.Background(), &coordinatorpb.GetSpeedRequest{})
+	case strings.HasPrefix(action, "turtle_"):
+		enabled := action == "turtle_on"
+		settings, err = sc.bot.coordClient.SetSpeed(context.Background(), &coordinatorpb.SetSpeedRequest{
+			AltSpeedEnabled: &enabled,
+		})
+	case strings.HasPrefix(action, "preset_"):
+		index, convErr := strconv.Atoi(strings.TrimPrefix(action, "preset_"))
+		if convErr != nil || index < 0 || index >= len(speedPresets) {
+			sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❓ Unknown preset"))
+			return
+		}
+		settings, err = sc.bot.coordClient.SetSpeed(context.Background(), presetRequest(speedPresets[index]))
+	default:
+		sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to update speed settings: %v", err)
+		sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❌ Couldn't update the speed settings"))
+		return
+	}
+
+	sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+
+	keyboard := speedKeyboard(settings)
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, formatSpeedSettings(settings))
+	editMsg.ReplyMarkup = &keyboard
+	sc.bot.api.Send(editMsg)
+}
+
+func presetRequest(preset speedPreset) *coordinatorpb.SetSpeedRequest {
+	downEnabled := preset.Down > 0
+	upEnabled := preset.Up > 0
+	req := &coordinatorpb.SetSpeedRequest{
+		SpeedLimitDownEnabled: &downEnabled,
+		SpeedLimitUpEnabled:   &upEnabled,
+	}
+	if downEnabled {
+		req.SpeedLimitDown = &preset.Down
+	}
+	if upEnabled {
+		req.SpeedLimitUp = &preset.Up
+	}
+	return req
+}
+
+func speedKeyboard(settings *coordinatorpb.SpeedSettings) tgbotapi.InlineKeyboardMarkup {
+	turtleButton := tgbotapi.NewInlineKeyboardButtonData("🐢 Turtle mode: off", "speed_turtle_on")
+	if settings.AltSpeedEnabled {
+		turtleButton = tgbotapi.NewInlineKeyboardButtonData("🐢 Turtle mode: on", "speed_turtle_off")
+	}
+
+	var presetButtons []tgbotapi.InlineKeyboardButton
+	for i, preset := range speedPresets {
+		presetButtons = append(presetButtons, tgbotapi.NewInlineKeyboardButtonData(preset.Label, fmt.Sprintf("speed_preset_%d", i)))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(turtleButton),
+		tgbotapi.NewInlineKeyboardRow(presetButtons[:2]...),
+		tgbotapi.NewInlineKeyboardRow(presetButtons[2:]...),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", "speed_refresh"),
+			tgbotapi.NewInlineKeyboardButtonData("🗑️ Close", "speed_close"),
+		),
+	)
+}
+
+func formatSpeedSettings(settings *coordinatorpb.SpeedSettings) string {
+	turtle := "off"
+	if settings.AltSpeedEnabled {
+		turtle = fmt.Sprintf("on (⬇️ %s, ⬆️ %s)", formatLimit(true, settings.AltSpeedDown), formatLimit(true, settings.AltSpeedUp))
+	}
+
+	return fmt.Sprintf("🚀 Speed:\n\n⬇️ Download: %s (limit: %s)\n⬆️ Upload: %s (limit: %s)\n🐢 Turtle mode: %s",
+		formatRate(settings.DownloadRate),
+		formatLimit(settings.SpeedLimitDownEnabled, settings.SpeedLimitDown),
+		formatRate(settings.UploadRate),
+		formatLimit(settings.SpeedLimitUpEnabled, settings.SpeedLimitUp),
+		turtle,
+	)
+}
+
+func formatLimit(enabled bool, kbps int64) string {
+	if !enabled {
+		return "none"
+	}
+	return formatRate(kbps * 1024)
+}
+
+func formatRate(bytesPerSecond int64) string {
+	switch {
+	case bytesPerSecond >= 1024*1024:
+		return fmt.Sprintf("%.1f MB/s", float64(bytesPerSecond)/(1024*1024))
+	case bytesPerSecond >= 1024:
+		return fmt.Sprintf("%.1f KB/s", float64(bytesPerSecond)/1024)
+	default:
+		return fmt.Sprintf("%d B/s", bytesPerSecond)
+	}
+}
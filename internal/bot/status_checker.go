@@ -62,6 +62,11 @@ func (sc *StatusChecker) HandleCallback(callback *tgbotapi.CallbackQuery) {
 		return
 	}
 
+	if strings.HasPrefix(callback.Data, "priority_") {
+		sc.handlePriorityCallback(callback)
+		return
+	}
+
 	if strings.HasPrefix(callback.Data, "status_") {
 		requestID := strings.TrimPrefix(callback.Data, "status_")
 		sc.editDetailedStatus(callback.Message.Chat.ID, callback.Message.MessageID, requestID)
@@ -111,6 +116,10 @@ func getStatusText(status coordinatorpb.DownloadStatus) string {
 		return "✅"
 	case coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR:
 		return "❌"
+	case coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SCHEDULED:
+		return "🕒"
+	case coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_QUEUED:
+		return "📋"
 	default:
 		return "❓"
 	}
@@ -252,22 +261,57 @@ func (sc *StatusChecker) editDetailedStatus(chatID int64, messageID int, request
 		etaText = fmt.Sprintf("\n⏱️ ETA: %s", formatDuration(status.ETA))
 	}
 
-	message := fmt.Sprintf("📥 Download Details:\n\n📁 Name: %s\n%s \n📊 Progress: %s%s\n💬 Message: %s\n",
+	message := fmt.Sprintf("📥 Download Details:\n\n📁 Name: %s\n%s \n📊 Progress: %s%s%s\n💬 Message: %s\n",
 		status.Name,
 		statusText,
 		progressBar,
 		etaText,
+		status.TransferDetails(),
 		status.Message,
 	)
 
+	var rows [][]tgbotapi.InlineKeyboardButton
+	if status.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_QUEUED || status.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SCHEDULED {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔺 High", fmt.Sprintf("priority_high_%s", requestID)),
+			tgbotapi.NewInlineKeyboardButtonData("▪️ Normal", fmt.Sprintf("priority_normal_%s", requestID)),
+			tgbotapi.NewInlineKeyboardButtonData("🔻 Low", fmt.Sprintf("priority_low_%s", requestID)),
+		))
+	}
+
 	// Create back button
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("⬅️ Back to List", "refresh_status"),
-		),
-	)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⬅️ Back to List", "refresh_status"),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
 
 	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, message)
 	editMsg.ReplyMarkup = &keyboard
 	sc.bot.api.Send(editMsg)
 }
+
+func (sc *StatusChecker) handlePriorityCallback(callback *tgbotapi.CallbackQuery) {
+	level, requestID, _ := strings.Cut(strings.TrimPrefix(callback.Data, "priority_"), "_")
+
+	priority, ok := priorityLevels[level]
+	if !ok {
+		sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❓ Unknown priority"))
+		return
+	}
+
+	resp, err := sc.bot.coordClient.SetPriority(context.Background(), &coordinatorpb.SetPriorityRequest{
+		RequestId: requestID,
+		Priority:  priority,
+	})
+	if err != nil {
+		log.Printf("Failed to set priority: %v", err)
+		sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❌ Couldn't change the priority"))
+		return
+	}
+
+	text := fmt.Sprintf("Priority set to %s", level)
+	if resp.QueuePosition > 0 {
+		text += fmt.Sprintf(", queue position %d", resp.QueuePosition)
+	}
+	sc.bot.api.Send(tgbotapi.NewCallback(callback.ID, text))
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/internal/units"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	torrentsPageSize    = 10
+	torrentNameMaxRunes = 60
+)
+
+var torrentStateIcons = map[coordinatorpb.TorrentState]string{
+	coordinatorpb.TorrentState_TORRENT_STATE_STOPPED:     "⏸️",
+	coordinatorpb.TorrentState_TORRENT_STATE_DOWNLOADING: "⬇️",
+	coordinatorpb.TorrentState_TORRENT_STATE_DONE:        "✅",
+	coordinatorpb.TorrentState_TORRENT_STATE_ERROR:       "❌",
+}
+
+// TorrentsView pages through every torrent in the torrent client and adopts untracked ones
+type TorrentsView struct {
+	bot *Bot
+}
+
+func NewTorrentsView(bot *Bot) *TorrentsView {
+	return &TorrentsView{
+		bot: bot,
+	}
+}
+
+func (tv *TorrentsView) ShowTorrents(chatID int64) {
+	text, keyboard, err := tv.renderPage(0)
+	if err != nil {
+		tv.bot.api.Send(tgbotapi.NewMessage(chatID, "❌ Oops! I couldn't list the torrents. Please try again later!"))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	tv.bot.api.Send(msg)
+}
+
+// HandleCallback handles torrents_page_<page>, torrents_adopt_<page>_<torrentID>,
+// torrents_cat_<page>_<torrentID>_<category> and torrents_close
+func (tv *TorrentsView) HandleCallback(callback *tgbotapi.CallbackQuery) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+	parts := strings.Split(strings.TrimPrefix(callback.Data, "torrents_"), "_")
+
+	args := make([]int64, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		value, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❓ Unknown action"))
+			return
+		}
+		args = append(args, value)
+	}
+
+	switch {
+	case parts[0] == "close":
+		tv.bot.api.Send(tgbotapi.NewDeleteMessage(chatID, messageID))
+		return
+
+	case parts[0] == "page" && len(args) == 1:
+		tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+		tv.editPage(chatID, messageID, int(args[0]))
+
+	case parts[0] == "adopt" && len(args) == 2:
+		tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, ""))
+
+		keyboard := adoptKeyboard(int(args[0]), args[1])
+		editMsg := tgbotapi.NewEditMessageText(chatID, messageID, fmt.Sprintf("📥 Which category should torrent #%d be adopted into?", args[1]))
+		editMsg.ReplyMarkup = &keyboard
+		tv.bot.api.Send(editMsg)
+
+	case parts[0] == "cat" && len(args) == 3:
+		tv.adopt(callback, int(args[0]), args[1], common.RequestType(args[2]))
+
+	default:
+		tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❓ Unknown action"))
+	}
+}
+
+func (tv *TorrentsView) adopt(callback *tgbotapi.CallbackQuery, page int, torrentID int64, category common.RequestType) {
+	chatID := callback.Message.Chat.ID
+
+	resp, err := tv.bot.coordClient.AdoptTorrent(context.Background(), &coordinatorpb.AdoptTorrentRequest{
+		RequestId: uuid.New().String(),
+		TorrentId: torrentID,
+		Category:  category,
+		Requester: strconv.FormatInt(chatID, 10),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, "🔁 This torrent is already tracked"))
+		tv.editPage(chatID, callback.Message.MessageID, page)
+		return
+	}
+	if status.Code(err) == codes.FailedPrecondition {
+		tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❌ Couldn't adopt the torrent"))
+		tv.bot.api.Send(tgbotapi.NewMessage(chatID, "❌ Couldn't adopt torrent #"+strconv.FormatInt(torrentID, 10)+": "+status.Convert(err).Message()))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to adopt torrent: %v", err)
+		tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, "❌ Couldn't adopt the torrent"))
+		return
+	}
+
+	tv.bot.api.Send(tgbotapi.NewCallback(callback.ID, "📥 Torrent adopted"))
+
+	text := "📥 Torrent adopted into " + categoryNames[category] + "!\n📁 Torrent name: " + resp.Name
+	if err := tv.bot.trackDownload(chatID, resp); err != nil {
+		text += "\n⚠️ I couldn't save the status locally, you won't get progress updates for it"
+	}
+	tv.bot.api.Send(tgbotapi.NewMessage(chatID, text))
+
+	tv.editPage(chatID, callback.Message.MessageID, page)
+}
+
+func (tv *TorrentsView) editPage(chatID int64, messageID int, page int) {
+	text, keyboard, err := tv.renderPage(page)
+	if err != nil {
+		text = "❌ Oops! I couldn't list the torrents. Please try again later!"
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", fmt.Sprintf("torrents_page_%d", page)),
+		))
+	}
+
+	editMsg := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	editMsg.ReplyMarkup = &keyboard
+	tv.bot.api.Send(editMsg)
+}
+
+func (tv *TorrentsView) renderPage(page int) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	resp, err := tv.bot.coordClient.ListTorrents(context.Background(), &coordinatorpb.ListTorrentsRequest{
+		Offset: int32(page * torrentsPageSize),
+		Limit:  torrentsPageSize,
+	})
+	if err != nil {
+		log.Printf("Failed to list torrents: %v", err)
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	pages := max(1, (int(resp.Total)+torrentsPageSize-1)/torrentsPageSize)
+	if page >= pages && resp.Total > 0 {
+		// The list shrank since the page was shown
+		return tv.renderPage(pages - 1)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧲 Torrents (page %d/%d, %d total):\n", page+1, pages, resp.Total))
+	if len(resp.Torrents) == 0 {
+		sb.WriteString("\nNo torrents found")
+	}
+
+	var adoptButtons []tgbotapi.InlineKeyboardButton
+	for i, torrent := range resp.Torrents {
+		number := page*torrentsPageSize + i + 1
+		icon, ok := torrentStateIcons[torrent.State]
+		if !ok {
+			icon = "❔"
+		}
+
+		owner := "👤 untracked"
+		if torrent.RequestId != "" {
+			owner = "🤖 " + categoryNames[torrent.Category]
+		} else {
+			adoptButtons = append(adoptButtons, tgbotapi.NewInlineKeyboardButtonData(
+				fmt.Sprintf("📥 %d", number),
+				fmt.Sprintf("torrents_adopt_%d_%d", page, torrent.TorrentId),
+			))
+		}
+
+		sb.WriteString(fmt.Sprintf("\n%d. %s %s\n   %.1f%% of %s, %s\n", number, icon, truncateName(torrent.Name), torrent.Progress, units.FormatBytes(torrent.SizeBytes), owner))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for start := 0; start < len(adoptButtons); start += 5 {
+		rows = append(rows, adoptButtons[start:min(start+5, len(adoptButtons))])
+	}
+
+	var navRow []tgbotapi.InlineKeyboardButton
+	if page > 0 {
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", fmt.Sprintf("torrents_page_%d", page-1)))
+	}
+	navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("🔄 Refresh", fmt.Sprintf("torrents_page_%d", page)))
+	if page+1 < pages {
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("Next ➡️", fmt.Sprintf("torrents_page_%d", page+1)))
+	}
+	rows = append(rows, navRow, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("🗑️ Close", "torrents_close")))
+
+	if len(adoptButtons) > 0 {
+		sb.WriteString("\nTap 📥 to adopt an untracked torrent into a category")
+	}
+
+	return sb.String(), tgbotapi.NewInlineKeyboardMarkup(rows...), nil
+}
+
+func adoptKeyboard(page int, torrentID int64) tgbotapi.InlineKeyboardMarkup {
+	button := func(category common.RequestType) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(categoryNames[category], fmt.Sprintf("torrents_cat_%d_%d_%d", page, torrentID, category))
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(button(common.RequestType_FILMS), button(common.RequestType_SERIES)),
+		tgbotapi.NewInlineKeyboardRow(button(common.RequestType_CARTOONS), button(common.RequestType_CARTOONS_SERIES)),
+		tgbotapi.NewInlineKeyboardRow(button(common.RequestType_SHORTS)),
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("⬅️ Back", fmt.Sprintf("torrents_page_%d", page))),
+	)
+}
+
+func truncateName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= torrentNameMaxRunes {
+		return name
+	}
+	return string(runes[:torrentNameMaxRunes-1]) + "…"
+}
@@ -3,9 +3,11 @@ package bot
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/internal/units"
 )
 
 type DownloadStatus struct {
@@ -14,15 +16,60 @@ type DownloadStatus struct {
 	Message  string
 	ETA      time.Duration
 	Progress float64
+	// Transfer details, zero until the torrent client reports them
+	SizeBytes          int64
+	DownloadedBytes    int64
+	UploadedBytes      int64
+	UploadRatio        float64
+	DownloadRate       int64
+	UploadRate         int64
+	PeersConnected     int64
+	PeersSendingToUs   int64
+	PeersGettingFromUs int64
+	TrackerStatus      string
+	ErrorString        string
+}
+
+// NewDownloadStatus converts a coordinator progress update
+func NewDownloadStatus(resp *coordinatorpb.DownloadResponse) *DownloadStatus {
+	return &DownloadStatus{
+		Name:               resp.Name,
+		Status:             resp.Status,
+		Message:            resp.Message,
+		ETA:                time.Duration(resp.Eta) * time.Second,
+		Progress:           resp.Progress,
+		SizeBytes:          resp.SizeBytes,
+		DownloadedBytes:    resp.DownloadedBytes,
+		UploadedBytes:      resp.UploadedBytes,
+		UploadRatio:        resp.UploadRatio,
+		DownloadRate:       int64(resp.DownloadRate),
+		UploadRate:         int64(resp.UploadRate),
+		PeersConnected:     int64(resp.PeersConnected),
+		PeersSendingToUs:   int64(resp.PeersSendingToUs),
+		PeersGettingFromUs: int64(resp.PeersGettingFromUs),
+		TrackerStatus:      resp.TrackerStatus,
+		ErrorString:        resp.ErrorString,
+	}
 }
 
 func (d *DownloadStatus) ToRedisMap() map[string]string {
 	return map[string]string{
-		"name":     d.Name,
-		"status":   d.Status.String(),
-		"message":  d.Message,
-		"eta":      d.ETA.String(),
-		"progress": fmt.Sprintf("%f", d.Progress),
+		"name":                  d.Name,
+		"status":                d.Status.String(),
+		"message":               d.Message,
+		"eta":                   d.ETA.String(),
+		"progress":              fmt.Sprintf("%f", d.Progress),
+		"size_bytes":            strconv.FormatInt(d.SizeBytes, 10),
+		"downloaded_bytes":      strconv.FormatInt(d.DownloadedBytes, 10),
+		"uploaded_bytes":        strconv.FormatInt(d.UploadedBytes, 10),
+		"upload_ratio":          fmt.Sprintf("%f", d.UploadRatio),
+		"download_rate":         strconv.FormatInt(d.DownloadRate, 10),
+		"upload_rate":           strconv.FormatInt(d.UploadRate, 10),
+		"peers_connected":       strconv.FormatInt(d.PeersConnected, 10),
+		"peers_sending_to_us":   strconv.FormatInt(d.PeersSendingToUs, 10),
+		"peers_getting_from_us": strconv.FormatInt(d.PeersGettingFromUs, 10),
+		"tracker_status":        d.TrackerStatus,
+		"error_string":          d.ErrorString,
 	}
 }
 
@@ -53,9 +100,49 @@ func (d *DownloadStatus) FromRedisMap(m map[string]string) error {
 	}
 	d.Progress = progress
 
+	// Transfer details are missing from statuses saved by older versions
+	d.SizeBytes, _ = strconv.ParseInt(m["size_bytes"], 10, 64)
+	d.DownloadedBytes, _ = strconv.ParseInt(m["downloaded_bytes"], 10, 64)
+	d.UploadedBytes, _ = strconv.ParseInt(m["uploaded_bytes"], 10, 64)
+	d.UploadRatio, _ = strconv.ParseFloat(m["upload_ratio"], 64)
+	d.DownloadRate, _ = strconv.ParseInt(m["download_rate"], 10, 64)
+	d.UploadRate, _ = strconv.ParseInt(m["upload_rate"], 10, 64)
+	d.PeersConnected, _ = strconv.ParseInt(m["peers_connected"], 10, 64)
+	d.PeersSendingToUs, _ = strconv.ParseInt(m["peers_sending_to_us"], 10, 64)
+	d.PeersGettingFromUs, _ = strconv.ParseInt(m["peers_getting_from_us"], 10, 64)
+	d.TrackerStatus = m["tracker_status"]
+	d.ErrorString = m["error_string"]
+
 	return nil
 }
 
+// TransferDetails describes sizes, rates, peers and errors, empty if nothing was reported yet
+func (d *DownloadStatus) TransferDetails() string {
+	var sb strings.Builder
+	if d.SizeBytes > 0 {
+		sb.WriteString(fmt.Sprintf("\n⬇️ Downloaded: %s of %s", units.FormatBytes(d.DownloadedBytes), units.FormatBytes(d.SizeBytes)))
+		if d.DownloadRate > 0 {
+			sb.WriteString(" at " + formatRate(d.DownloadRate))
+		}
+	}
+	if d.UploadedBytes > 0 || d.UploadRate > 0 {
+		sb.WriteString(fmt.Sprintf("\n⬆️ Uploaded: %s (ratio %.2f)", units.FormatBytes(d.UploadedBytes), d.UploadRatio))
+		if d.UploadRate > 0 {
+			sb.WriteString(" at " + formatRate(d.UploadRate))
+		}
+	}
+	if d.PeersConnected > 0 {
+		sb.WriteString(fmt.Sprintf("\n👥 Peers: %d connected, %d sending, %d receiving", d.PeersConnected, d.PeersSendingToUs, d.PeersGettingFromUs))
+	}
+	if d.TrackerStatus != "" {
+		sb.WriteString("\n📡 Tracker: " + d.TrackerStatus)
+	}
+	if d.ErrorString != "" {
+		sb.WriteString("\n⚠️ Error: " + d.ErrorString)
+	}
+	return sb.String()
+}
+
 func (d *DownloadStatus) ToLogString() string {
 	return fmt.Sprintf("Name: %s, Status: %s, Message: %s, ETA: %s, Progress: %f", d.Name, d.Status, d.Message, d.ETA, d.Progress)
 }
@@ -0,0 +1,259 @@
+package coordinator
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/nwaples/rardecode"
+)
+
+var (
+	// Volume number of a multi-part rar archive, e.g. movie.part02.rar
+	rarPartPattern = regexp.MustCompile(`(?i)\.part(\d+)\.rar$`)
+)
+
+// ExtractStagingDir is the hidden subdirectory of a category directory archives are extracted to, so that
+// the media servers don't pick up files while the archives are still being extracted
+const ExtractStagingDir = ".extracting"
+
+// extractDir returns the hidden directory the archives of a download are extracted to, as seen by the coordinator
+func (s *Service) extractDir(category common.RequestType, requestID string) string {
+	return filepath.Join(s.pathMapping.Apply(s.pbTypeToDownloadPath[category]), ExtractStagingDir, requestID)
+}
+
+// extractDownload extracts the zip and rar archives of a completed torrent into its hidden extraction
+// directory, under the folder the archive is in, and returns the extracted files relative to it.
+// They are imported from there, or published into the category directory with publishExtracted.
+func (s *Service) extractDownload(ctx context.Context, requestID string, record *TorrentRecord, name string) ([]string, error) {
+	files, err := s.transmissionClient.GetTorrentFiles(ctx, &transmission.GetTorrentFilesRequest{TorrentId: record.TorrentID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get torrent files: %w", err)
+	}
+
+	archives := findArchives(files.Files)
+	if len(archives) == 0 {
+		return nil, nil
+	}
+
+	sourceDir := s.pathMapping.Apply(files.DownloadDir)
+	extractDir := s.extractDir(record.Category, requestID)
+	var extracted []string
+
+	for i, archive := range archives {
+		log.Printf("Extracting archive (requestID: %s): %s", requestID, archive)
+
+		// The download is complete, the extraction of the current file is only shown in the message
+		progress := func(file string, percent float64) {
+			message := fmt.Sprintf("📦 Extracting archive %d/%d: %s (%.0f%%)", i+1, len(archives), file, percent)
+			if err := s.handleInProgress(ctx, requestID, name, 100, 0, message); err != nil {
+				log.Printf("failed to send extraction progress: %v", err)
+			}
+		}
+
+		destDir := filepath.Join(extractDir, filepath.Dir(archive))
+		names, err := extractArchive(filepath.Join(sourceDir, archive), destDir, progress)
+		if err != nil {
+			return extracted, fmt.Errorf("failed to extract %s: %w", filepath.Base(archive), err)
+		}
+
+		for _, n := range names {
+			extracted = append(extracted, filepath.Join(filepath.Dir(archive), n))
+		}
+	}
+
+	log.Printf("Archives extracted (requestID: %s, archives: %d, files: %d)", requestID, len(archives), len(extracted))
+	s.appendHistory(ctx, requestID, fmt.Sprintf("Extracted %d files from %d archives", len(extracted), len(archives)))
+
+	return extracted, nil
+}
+
+// publishExtracted moves the extracted files of a download into the category directory once every archive
+// is extracted, then removes its extraction directory. Files whose destination is taken are dropped, the
+// archives still hold them.
+func (s *Service) publishExtracted(requestID string, category common.RequestType, extracted []string) error {
+	extractDir := s.extractDir(category, requestID)
+	categoryDir := s.pathMapping.Apply(s.pbTypeToDownloadPath[category])
+
+	for _, file := range extracted {
+		dest := filepath.Join(categoryDir, file)
+		if _, err := os.Lstat(dest); err == nil {
+			log.Printf("Extracted file already exists, skipping it (requestID: %s): %s", requestID, file)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(extractDir, file), dest); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(extractDir)
+}
+
+// findArchives returns the zip archives and the first volume of each rar archive
+func findArchives(files []*transmission.TorrentFile) []string {
+	var archives []string
+	for _, f := range files {
+		if samplePattern.MatchString(f.Name) {
+			continue
+		}
+
+		switch strings.ToLower(filepath.Ext(f.Name)) {
+		case ".zip":
+			archives = append(archives, f.Name)
+		case ".rar":
+			if m := rarPartPattern.FindStringSubmatch(f.Name); m != nil && atoi32(m[1]) != 1 {
+				continue
+			}
+			archives = append(archives, f.Name)
+		}
+	}
+	return archives
+}
+
+// extractArchive extracts an archive into destDir and returns the extracted files relative to it
+func extractArchive(path string, destDir string, progress func(file string, percent float64)) ([]string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return extractZip(path, destDir, progress)
+	}
+	return extractRar(path, destDir, progress)
+}
+
+func extractZip(path string, destDir string, progress func(file string, percent float64)) ([]string, error) {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var names []string
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return names, err
+		}
+
+		name, err := writeArchiveEntry(destDir, f.Name, rc, int64(f.UncompressedSize64), progress)
+		rc.Close()
+		if err != nil {
+			return names, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func extractRar(path string, destDir string, progress func(file string, percent float64)) ([]string, error) {
+	r, err := rardecode.OpenReader(path, "")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var names []string
+	for {
+		header, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return names, err
+		}
+
+		if header.IsDir {
+			continue
+		}
+
+		size := header.UnPackedSize
+		if header.UnKnownSize {
+			size = 0
+		}
+
+		name, err := writeArchiveEntry(destDir, header.Name, r, size, progress)
+		if err != nil {
+			return names, err
+		}
+
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// writeArchiveEntry writes an archive entry under destDir and returns its relative path.
+// Entries that were extracted already are skipped.
+func writeArchiveEntry(destDir string, name string, r io.Reader, size int64, progress func(file string, percent float64)) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+
+	dest := filepath.Join(destDir, rel)
+	if _, err := os.Stat(dest); err == nil {
+		return rel, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file so an interrupted extraction is not taken for a complete one
+	tmp := dest + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	w := &progressWriter{w: f, size: size, report: func(percent float64) { progress(filepath.Base(rel), percent) }}
+	_, err = io.Copy(w, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	return rel, os.Rename(tmp, dest)
+}
+
+// progressWriter reports the written share of an entry every 10%
+type progressWriter struct {
+	w        io.Writer
+	size     int64
+	written  int64
+	reported int64
+	report   func(percent float64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.written += int64(n)
+
+	if p.size > 0 {
+		if step := p.written * 10 / p.size; step > p.reported {
+			p.reported = step
+			p.report(float64(p.written) * 100 / float64(p.size))
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,109 @@
+package coordinator
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+)
+
+// writeZip creates a zip archive holding the given files and contents
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := entry.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractedFilesStayHiddenUntilPublished(t *testing.T) {
+	categoryDir := t.TempDir()
+	s := &Service{pbTypeToDownloadPath: map[common.RequestType]string{common.RequestType_SERIES: categoryDir}}
+
+	archive := filepath.Join(t.TempDir(), "show.zip")
+	writeZip(t, archive, map[string]string{
+		"Show.S01E01.mkv":      "episode 1",
+		"Show.S01E02.mkv":      "episode 2",
+		"Subs/Show.S01E01.srt": "subtitles",
+	})
+
+	// An episode that is already in the library is left alone
+	if err := os.MkdirAll(filepath.Join(categoryDir, "Show"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(categoryDir, "Show", "Show.S01E02.mkv"), []byte("existing"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	extractDir := s.extractDir(common.RequestType_SERIES, "request")
+	names, err := extractArchive(archive, filepath.Join(extractDir, "Show"), func(string, float64) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var extracted []string
+	for _, name := range names {
+		extracted = append(extracted, filepath.Join("Show", name))
+	}
+	slices.Sort(extracted)
+	if want := []string{"Show/Show.S01E01.mkv", "Show/Show.S01E02.mkv", "Show/Subs/Show.S01E01.srt"}; !slices.Equal(extracted, want) {
+		t.Fatalf("extracted = %v, want %v", extracted, want)
+	}
+
+	if _, err := os.Stat(filepath.Join(categoryDir, "Show", "Show.S01E01.mkv")); !os.IsNotExist(err) {
+		t.Fatal("extracted files should not be in the category directory before they are published")
+	}
+
+	if err := s.publishExtracted("request", common.RequestType_SERIES, extracted); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, want := range map[string]string{
+		"Show/Show.S01E01.mkv":      "episode 1",
+		"Show/Show.S01E02.mkv":      "existing",
+		"Show/Subs/Show.S01E01.srt": "subtitles",
+	} {
+		content, err := os.ReadFile(filepath.Join(categoryDir, file))
+		if err != nil {
+			t.Errorf("%s: %v", file, err)
+		} else if string(content) != want {
+			t.Errorf("%s = %q, want %q", file, content, want)
+		}
+	}
+
+	if _, err := os.Stat(extractDir); !os.IsNotExist(err) {
+		t.Errorf("the extraction directory should be removed once published, got %v", err)
+	}
+}
+
+func TestExtractArchiveRejectsUnsafePaths(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.zip")
+	writeZip(t, archive, map[string]string{"../../escaped.mkv": "x"})
+
+	destDir := filepath.Join(t.TempDir(), "dest")
+	if _, err := extractArchive(archive, destDir, func(string, float64) {}); err == nil {
+		t.Fatal("an entry outside the destination should be refused")
+	}
+	if _, err := os.Stat(filepath.Join(destDir, "..", "..", "escaped.mkv")); !os.IsNotExist(err) {
+		t.Error("the unsafe entry should not be written")
+	}
+}
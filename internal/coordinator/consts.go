@@ -7,13 +7,53 @@ const (
 	KeyTorrentFormat = "coordinator:torrent:%s"
 	// KeyTorrentInProgress is the key for Redis storing torrent in progress
 	KeyTorrentInProgress = "coordinator:torrent:in_progress"
-	// KeyDownloadProgress is the key for Redis storing download progress
-	KeyDownloadProgress = "coordinator-bot:download:progress"
+	// KeyTorrentScheduled is the key for Redis storing scheduled torrents, scored by start time
+	KeyTorrentScheduled = "coordinator:torrent:scheduled"
+	// KeyTorrentQueued is the key for Redis storing queued torrents, scored by priority and enqueue time
+	KeyTorrentQueued = "coordinator:torrent:queued"
+	// KeyTorrentFinishing is the key for Redis storing completed downloads being extracted, imported and confirmed
+	KeyTorrentFinishing = "coordinator:torrent:finishing"
+	// KeyTorrentSeeding is the key for Redis storing completed torrents that are still seeding
+	KeyTorrentSeeding = "coordinator:torrent:seeding"
+	// KeyTorrentHistoryFormat is the format for Redis keys storing the history of a download
+	KeyTorrentHistoryFormat = "coordinator:torrent:%s:history"
+	// KeyDownloadEvents is the key for the Redis stream of download progress, read by the bot and WatchDownloads
+	KeyDownloadEvents = "coordinator-bot:download:events"
+	// KeyTorrentFinalFormat is the format for Redis keys storing the last final progress update of a download
+	KeyTorrentFinalFormat = "coordinator:torrent:%s:final"
+	// KeyTorrentOrphanedFormat is the format for Redis keys storing when a download the bot waits for was found unknown
+	KeyTorrentOrphanedFormat = "coordinator:torrent:%s:orphaned"
+	// KeyPendingDownloads is the key of the set where clients such as the bot register the downloads they
+	// wait a final update for, until they handled it
+	KeyPendingDownloads = "coordinator-bot:downloads:pending"
+	// KeyRequestLockFormat is the format for Redis keys locking an add request while it is handled
+	KeyRequestLockFormat = "coordinator:request:%s:lock"
+	// KeyRequestResponseFormat is the format for Redis keys storing the response of an add request
+	KeyRequestResponseFormat = "coordinator:request:%s:response"
+	// KeyRequestTorrentFormat is the format for Redis keys storing the torrent added for a request
+	KeyRequestTorrentFormat = "coordinator:request:%s:torrent"
+	// KeyAdoptLockFormat is the format for Redis keys locking a torrent while it is adopted, by torrent ID
+	KeyAdoptLockFormat = "coordinator:adopt:%d:lock"
+	// KeyTorrentRequesterFormat is the format for Redis keys storing who asked for a download
+	KeyTorrentRequesterFormat = "coordinator:torrent:%s:requester"
+	// KeyShows is the key for Redis storing normalized titles of watched shows
+	KeyShows = "coordinator:shows"
+	// KeyShowFormat is the format for Redis keys storing the display title of a watched show
+	KeyShowFormat = "coordinator:show:%s"
+	// KeyShowEpisodesFormat is the format for Redis keys storing downloaded episodes of a watched show
+	KeyShowEpisodesFormat = "coordinator:show:%s:episodes"
+
+	// requestLabelPrefix is the prefix of the torrent label the transmission service stores the request ID in
+	requestLabelPrefix = "mdb-"
 
 	// StaleThreshold is the time after which a record is considered stale
 	StaleThreshold = 10 * time.Minute
 	// CheckInterval is how often the recovery service checks for stale records
 	CheckInterval = 1 * time.Minute
+	// HistoryTTL is how long the history of a download is kept
+	HistoryTTL = 30 * 24 * time.Hour
+	// DownloadEventsRetention is how long progress updates are kept in the stream, read or not
+	DownloadEventsRetention = 7 * 24 * time.Hour
 	// EtaErrorSeconds is the number of seconds to add to ETA (because download is not always accurate)
 	EtaErrorSeconds = 10
 )
@@ -0,0 +1,484 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/aquare11e/media-downloader-bot/internal/units"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// directDownloadAttempts is how many times a direct download is resumed after a network error
+	directDownloadAttempts = 5
+	// directDownloadRetryDelay is the delay before resuming a failed direct download
+	directDownloadRetryDelay = 10 * time.Second
+	// partSuffix marks direct downloads that are not complete yet
+	partSuffix = ".part"
+	// directDownloadIdleTimeout aborts a download attempt when no data arrives for that long
+	directDownloadIdleTimeout = 2 * time.Minute
+	// directDownloadNameAttempts bounds the numbered names tried when a file name is taken
+	directDownloadNameAttempts = 100
+)
+
+// directDownloadClient has no overall timeout since a download can take hours, stalled connections
+// are caught by the dial, TLS handshake and response header timeouts and by the idle read timeout
+var directDownloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// directDownload tracks a running HTTP download, progress is read by the progress checker
+type directDownload struct {
+	cancel     context.CancelFunc
+	size       atomic.Int64 // 0 if unknown
+	downloaded atomic.Int64
+	rate       atomic.Int64 // Bytes per second
+
+	mu   sync.Mutex
+	done bool
+	err  error
+}
+
+func (d *directDownload) finish(err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.done = true
+	d.err = err
+}
+
+func (d *directDownload) result() (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.done, d.err
+}
+
+// directDownloads holds the downloads running in this coordinator
+type directDownloads struct {
+	mu        sync.Mutex
+	downloads map[string]*directDownload
+}
+
+func (d *directDownloads) get(requestID string) *directDownload {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.downloads[requestID]
+}
+
+func (d *directDownloads) set(requestID string, download *directDownload) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.downloads == nil {
+		d.downloads = make(map[string]*directDownload)
+	}
+	d.downloads[requestID] = download
+}
+
+func (d *directDownloads) remove(requestID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if download, ok := d.downloads[requestID]; ok {
+		download.cancel()
+		delete(d.downloads, requestID)
+	}
+}
+
+func (s *Service) AddDownloadByURL(ctx context.Context, req *coordinatorpb.AddDownloadByURLRequest) (*coordinatorpb.DownloadResponse, error) {
+	log.Printf("Adding direct download (requestID: %s, category: %s)", req.RequestId, req.Category)
+
+	return s.addOnce(ctx, req.RequestId, func() (*coordinatorpb.DownloadResponse, error) {
+		return s.addDownloadByURL(ctx, req)
+	})
+}
+
+func (s *Service) addDownloadByURL(ctx context.Context, req *coordinatorpb.AddDownloadByURLRequest) (*coordinatorpb.DownloadResponse, error) {
+	link, err := url.Parse(req.Url)
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "not an HTTP(S) URL: %s", req.Url)
+	}
+
+	if err := s.checkFreeSpaceBeforeAdd(ctx, req.Category); err != nil {
+		return nil, err
+	}
+
+	// The first request validates the link and names the file, its body is the start of the download
+	downloadCtx, cancel := context.WithCancel(context.Background())
+	resp, err := s.getDirectDownload(downloadCtx, req.Url, 0)
+	if err != nil {
+		cancel()
+		log.Printf("Error occurred (requestID: %s): %v", req.RequestId, err)
+		return nil, status.Errorf(codes.InvalidArgument, "failed to download %s: %v", req.Url, err)
+	}
+
+	dir := s.pathMapping.Apply(s.pbTypeToDownloadPath[req.Category])
+	name, err := reserveDirectDownloadName(dir, directDownloadName(resp, link))
+	if err != nil {
+		resp.Body.Close()
+		cancel()
+		log.Printf("failed to reserve a file name (requestID: %s): %v", req.RequestId, err)
+		return nil, status.Errorf(codes.Internal, "failed to create the download file: %v", err)
+	}
+
+	record := &TorrentRecord{
+		Category: req.Category,
+		Name:     name,
+		URL:      req.Url,
+		Priority: req.Priority,
+	}
+
+	// Check for a free slot and take it by adding the download at once
+	if s.queueEnabled() {
+		s.queueMu.Lock()
+		defer s.queueMu.Unlock()
+	}
+	queued := !s.canStartNow(ctx, req.Category)
+
+	fail := func(err error) (*coordinatorpb.DownloadResponse, error) {
+		resp.Body.Close()
+		cancel()
+		os.Remove(filepath.Join(dir, name+partSuffix))
+		return nil, err
+	}
+
+	err = s.redisClient.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, req.RequestId), record.ToRedisMap()).Err()
+	if err != nil {
+		return fail(status.Errorf(codes.Internal, "failed to save to Redis torrent record: %v", err))
+	}
+
+	s.saveRequester(ctx, req.RequestId, req.Requester)
+
+	if queued {
+		// The download starts over from the queue, the reserved partial file keeps its name
+		resp.Body.Close()
+		cancel()
+
+		position, err := s.enqueue(ctx, req.RequestId, record)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to queue download: %v", err)
+		}
+
+		log.Printf("Direct download queued (requestID: %s, name: %s)", req.RequestId, name)
+		return &coordinatorpb.DownloadResponse{
+			Name:      name,
+			RequestId: req.RequestId,
+			Progress:  0,
+			Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_QUEUED,
+			Message:   fmt.Sprintf("📋 Download queued (position %d)", position),
+		}, nil
+	}
+
+	err = s.redisClient.SAdd(ctx, KeyTorrentInProgress, req.RequestId).Err()
+	if err != nil {
+		return fail(status.Errorf(codes.Internal, "failed to add to Redis requestID to in progress set: %v", err))
+	}
+	s.wakeProgressChecker()
+
+	log.Printf("Direct download added (requestID: %s, name: %s)", req.RequestId, name)
+	s.appendHistory(ctx, req.RequestId, fmt.Sprintf("Direct download started: %s from %s", name, link.Host))
+
+	s.runDirectDownload(downloadCtx, cancel, req.RequestId, record, resp)
+
+	return &coordinatorpb.DownloadResponse{
+		Name:      name,
+		RequestId: req.RequestId,
+		Progress:  0,
+		Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_IN_PROGRESS,
+		Message:   "Download started",
+	}, nil
+}
+
+// ResumeDirectDownloads restarts the direct downloads that were running when the coordinator stopped
+func (s *Service) ResumeDirectDownloads(ctx context.Context) {
+	requestIDs, err := s.redisClient.SMembers(ctx, KeyTorrentInProgress).Result()
+	if err != nil {
+		log.Printf("failed to get in progress downloads: %v", err)
+		return
+	}
+
+	for _, requestID := range requestIDs {
+		record, err := s.getTorrentRecord(ctx, requestID)
+		if err != nil || record.URL == "" || s.directDownloads.get(requestID) != nil {
+			continue
+		}
+
+		log.Printf("Resuming direct download (requestID: %s, name: %s)", requestID, record.Name)
+		s.appendHistory(ctx, requestID, "Direct download resumed after restart")
+
+		downloadCtx, cancel := context.WithCancel(context.Background())
+		s.runDirectDownload(downloadCtx, cancel, requestID, record, nil)
+	}
+}
+
+// runDirectDownload streams the download in the background, resuming it with Range requests on errors.
+// resp is the already opened first response, nil to start from the partial file.
+func (s *Service) runDirectDownload(ctx context.Context, cancel context.CancelFunc, requestID string, record *TorrentRecord, resp *http.Response) {
+	download := &directDownload{cancel: cancel}
+	s.directDownloads.set(requestID, download)
+
+	dest := filepath.Join(s.pathMapping.Apply(s.pbTypeToDownloadPath[record.Category]), record.Name)
+
+	go func() {
+		var err error
+		for attempt := 1; attempt <= directDownloadAttempts; attempt++ {
+			if err = s.streamDirectDownload(ctx, download, record.URL, dest, resp); err == nil {
+				break
+			}
+			resp = nil
+
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				break
+			}
+
+			log.Printf("direct download interrupted (requestID: %s, attempt: %d): %v", requestID, attempt, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(directDownloadRetryDelay):
+			}
+		}
+
+		if err == nil {
+			// Unlike a rename, a link doesn't replace a file created at the destination in the meantime
+			if err = os.Link(dest+partSuffix, dest); err == nil {
+				os.Remove(dest + partSuffix)
+			}
+		}
+
+		if err != nil {
+			log.Printf("direct download failed (requestID: %s): %v", requestID, err)
+			if ctx.Err() == nil {
+				s.appendHistory(context.Background(), requestID, "Direct download failed: "+err.Error())
+			}
+		} else {
+			log.Printf("Direct download finished (requestID: %s, path: %s)", requestID, dest)
+		}
+		download.finish(err)
+	}()
+}
+
+// streamDirectDownload appends the rest of the file to its partial file
+func (s *Service) streamDirectDownload(ctx context.Context, download *directDownload, rawURL string, dest string, resp *http.Response) error {
+	partPath := dest + partSuffix
+
+	offset := int64(0)
+	if resp == nil {
+		if info, err := os.Stat(partPath); err == nil {
+			offset = info.Size()
+		}
+
+		var err error
+		resp, err = s.getDirectDownload(ctx, rawURL, offset)
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	// The partial file already holds the whole file
+	if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+		return nil
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if resp.StatusCode != http.StatusPartialContent {
+		// The server ignored the range, start over
+		offset = 0
+		flags |= os.O_TRUNC
+	}
+
+	if resp.ContentLength >= 0 {
+		download.size.Store(offset + resp.ContentLength)
+	}
+	download.downloaded.Store(offset)
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	file, err := os.OpenFile(partPath, flags, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", partPath, err)
+	}
+	defer file.Close()
+
+	// Closing the body unblocks a read that gets no data, the attempt is then retried
+	idle := time.AfterFunc(directDownloadIdleTimeout, func() { resp.Body.Close() })
+	defer idle.Stop()
+
+	buf := make([]byte, 256*1024)
+	started := time.Now()
+	startedAt := offset
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if !idle.Reset(directDownloadIdleTimeout) {
+			return fmt.Errorf("no data received for %s", directDownloadIdleTimeout)
+		}
+		if n > 0 {
+			if _, err := file.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to write %s: %w", partPath, err)
+			}
+
+			downloaded := download.downloaded.Add(int64(n))
+			if elapsed := time.Since(started).Seconds(); elapsed > 0 {
+				download.rate.Store(int64(float64(downloaded-startedAt) / elapsed))
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("failed to read response: %w", readErr)
+		}
+	}
+
+	if size := download.size.Load(); size > 0 && download.downloaded.Load() < size {
+		return fmt.Errorf("connection closed after %s of %s", units.FormatBytes(download.downloaded.Load()), units.FormatBytes(size))
+	}
+
+	return file.Sync()
+}
+
+func (s *Service) getDirectDownload(ctx context.Context, rawURL string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := directDownloadClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	rangeDone := offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent && !rangeDone {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return resp, nil
+}
+
+// directDownloadName names the file after the Content-Disposition header or the last URL path segment
+func directDownloadName(resp *http.Response, link *url.URL) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	if name == "" || name == "." || name == "/" {
+		name = link.Host
+	}
+
+	name = strings.TrimSpace(unsafePathPattern.ReplaceAllString(filepath.Base(name), " "))
+	if name == "" || name == "." || name == ".." {
+		name = "download"
+	}
+	return name
+}
+
+// reserveDirectDownloadName returns a name that is free in dir, numbering it if needed, e.g. "Movie (2).mkv".
+// The name is reserved by creating its partial file, so that concurrent downloads don't share a partial
+// file and a finished download doesn't replace an existing file.
+func reserveDirectDownloadName(dir string, name string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; i <= directDownloadNameAttempts; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+
+		if _, err := os.Lstat(filepath.Join(dir, candidate)); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		f, err := os.OpenFile(filepath.Join(dir, candidate+partSuffix), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return candidate, f.Close()
+	}
+
+	return "", fmt.Errorf("no free name for %s in %s", name, dir)
+}
+
+// directDownloadStatus reports a direct download in the shape of a torrent status
+func (s *Service) directDownloadStatus(requestID string, record *TorrentRecord) (*transmission.GetTorrentStatusResponse, error) {
+	download := s.directDownloads.get(requestID)
+	if download == nil {
+		return nil, status.Error(codes.NotFound, "direct download is not running")
+	}
+
+	size := download.size.Load()
+	downloaded := download.downloaded.Load()
+	rate := download.rate.Load()
+
+	statusResp := &transmission.GetTorrentStatusResponse{
+		Name:            record.Name,
+		SizeBytes:       size,
+		DownloadedBytes: downloaded,
+		DownloadRate:    int32(rate),
+		Status:          transmission.TorrentStatus_STATUS_IN_PROGRESS,
+		State:           transmission.TorrentState_STATE_DOWNLOADING,
+		Eta:             -1,
+	}
+
+	if size > 0 {
+		statusResp.Progress = float64(downloaded) / float64(size) * 100
+		if rate > 0 {
+			statusResp.Eta = int32((size - downloaded) / rate)
+		}
+	}
+
+	if done, err := download.result(); done {
+		statusResp.Status = transmission.TorrentStatus_STATUS_DONE
+		statusResp.State = transmission.TorrentState_STATE_FINISHED
+		statusResp.Progress = 100
+		statusResp.Eta = 0
+		if err != nil {
+			statusResp.Status = transmission.TorrentStatus_STATUS_ERROR
+			statusResp.State = transmission.TorrentState_STATE_ERROR
+			statusResp.ErrorString = err.Error()
+		}
+	}
+
+	return statusResp, nil
+}
@@ -0,0 +1,74 @@
+package coordinator
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirectDownloadName(t *testing.T) {
+	tests := []struct {
+		name        string
+		link        string
+		disposition string
+		want        string
+	}{
+		{name: "url path", link: "https://example.com/files/Movie.2019.mkv", want: "Movie.2019.mkv"},
+		{name: "escaped url path", link: "https://example.com/files/My%20Movie.mkv", want: "My Movie.mkv"},
+		{name: "content disposition", link: "https://example.com/get?id=1", disposition: `attachment; filename="Show S01E01.mkv"`, want: "Show S01E01.mkv"},
+		{name: "content disposition with a path", link: "https://example.com/get", disposition: `attachment; filename="../../etc/passwd"`, want: "passwd"},
+		{name: "unsafe characters", link: "https://example.com/get", disposition: `attachment; filename="What? Movie: Part 1.mkv"`, want: "What  Movie  Part 1.mkv"},
+		{name: "invalid content disposition", link: "https://example.com/video.mp4", disposition: `attachment; filename=`, want: "video.mp4"},
+		{name: "no path", link: "https://example.com", want: "example.com"},
+		{name: "root path", link: "https://example.com/", want: "example.com"},
+		{name: "only unsafe characters", link: "https://example.com/get", disposition: `attachment; filename="???"`, want: "download"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := url.Parse(tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := &http.Response{Header: http.Header{}, Request: &http.Request{URL: link}}
+			if tt.disposition != "" {
+				resp.Header.Set("Content-Disposition", tt.disposition)
+			}
+
+			if got := directDownloadName(resp, link); got != tt.want {
+				t.Errorf("directDownloadName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReserveDirectDownloadName(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Movie.mkv"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The existing file is kept and every reservation gets its own partial file
+	for _, want := range []string{"Movie (2).mkv", "Movie (3).mkv"} {
+		got, err := reserveDirectDownloadName(dir, "Movie.mkv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("reserveDirectDownloadName() = %q, want %q", got, want)
+		}
+		if _, err := os.Stat(filepath.Join(dir, got+partSuffix)); err != nil {
+			t.Errorf("%s is not reserved: %v", got, err)
+		}
+	}
+
+	got, err := reserveDirectDownloadName(filepath.Join(dir, "Show"), "Show S01E01.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Show S01E01.mkv" {
+		t.Errorf("reserveDirectDownloadName() = %q in a new directory, want the name as is", got)
+	}
+}
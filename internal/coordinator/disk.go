@@ -0,0 +1,138 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/aquare11e/media-downloader-bot/internal/units"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DiskSpacePolicy defines what happens when a download doesn't fit on the disk
+type DiskSpacePolicy string
+
+const (
+	// DiskSpacePolicyWarn keeps downloading and warns the requester
+	DiskSpacePolicyWarn DiskSpacePolicy = "warn"
+	// DiskSpacePolicyRefuse refuses new downloads and stops the ones that don't fit
+	DiskSpacePolicyRefuse DiskSpacePolicy = "refuse"
+)
+
+// ParseDiskSpacePolicy parses a policy name, empty defaults to warn
+func ParseDiskSpacePolicy(value string) (DiskSpacePolicy, error) {
+	switch DiskSpacePolicy(value) {
+	case "", DiskSpacePolicyWarn:
+		return DiskSpacePolicyWarn, nil
+	case DiskSpacePolicyRefuse:
+		return DiskSpacePolicyRefuse, nil
+	default:
+		return "", fmt.Errorf("unknown disk space policy %q, expected %q or %q", value, DiskSpacePolicyWarn, DiskSpacePolicyRefuse)
+	}
+}
+
+func (s *Service) GetDiskUsage(ctx context.Context, req *coordinatorpb.GetDiskUsageRequest) (*coordinatorpb.GetDiskUsageResponse, error) {
+	categories := make([]common.RequestType, 0, len(s.pbTypeToDownloadPath))
+	for category := range s.pbTypeToDownloadPath {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i] < categories[j] })
+
+	directories := make([]*coordinatorpb.DiskUsage, 0, len(categories))
+	for _, category := range categories {
+		path := s.pbTypeToDownloadPath[category]
+		usage := &coordinatorpb.DiskUsage{
+			Category: category,
+			Path:     path,
+		}
+
+		space, err := s.transmissionClient.GetFreeSpace(ctx, &transmission.GetFreeSpaceRequest{Path: path})
+		if err != nil {
+			log.Printf("failed to get free space (path: %s): %v", path, err)
+			usage.Error = status.Convert(err).Message()
+		} else {
+			usage.FreeBytes = space.FreeBytes
+			usage.TotalBytes = space.TotalBytes
+		}
+
+		directories = append(directories, usage)
+	}
+
+	return &coordinatorpb.GetDiskUsageResponse{Directories: directories}, nil
+}
+
+// checkFreeSpaceBeforeAdd refuses new downloads when the category directory is below the free space reserve
+func (s *Service) checkFreeSpaceBeforeAdd(ctx context.Context, category common.RequestType) error {
+	if s.diskSpacePolicy != DiskSpacePolicyRefuse || s.minFreeSpaceBytes <= 0 {
+		return nil
+	}
+
+	path := s.pbTypeToDownloadPath[category]
+	space, err := s.transmissionClient.GetFreeSpace(ctx, &transmission.GetFreeSpaceRequest{Path: path})
+	if err != nil {
+		log.Printf("failed to check free space, adding anyway (path: %s): %v", path, err)
+		return nil
+	}
+
+	if space.FreeBytes < s.minFreeSpaceBytes {
+		log.Printf("Refusing download, not enough free space (path: %s, free: %d)", path, space.FreeBytes)
+		return status.Errorf(codes.ResourceExhausted, "only %s free in %s", units.FormatBytes(space.FreeBytes), path)
+	}
+
+	return nil
+}
+
+// checkDiskSpace compares the remaining size of a download with the free space once the size is known.
+// It returns true if the download was stopped because it doesn't fit.
+func (s *Service) checkDiskSpace(ctx context.Context, requestID string, record *TorrentRecord, statusResp *transmission.GetTorrentStatusResponse) bool {
+	if record.SpaceChecked || statusResp.SizeBytes <= 0 {
+		return false
+	}
+
+	path := s.pbTypeToDownloadPath[record.Category]
+	space, err := s.transmissionClient.GetFreeSpace(ctx, &transmission.GetFreeSpaceRequest{Path: path})
+	if err != nil {
+		log.Printf("failed to check free space (requestID: %s, path: %s): %v", requestID, path, err)
+		return false
+	}
+
+	record.SpaceChecked = true
+	key := fmt.Sprintf(KeyTorrentFormat, requestID)
+	if err := s.redisClient.HSet(ctx, key, "space_checked", true).Err(); err != nil {
+		log.Printf("failed to save space check (requestID: %s): %v", requestID, err)
+	}
+
+	remaining := statusResp.SizeBytes - statusResp.DownloadedBytes
+	if space.FreeBytes-remaining >= s.minFreeSpaceBytes {
+		return false
+	}
+
+	message := fmt.Sprintf("Not enough disk space: needs %s, %s free in %s", units.FormatBytes(remaining), units.FormatBytes(space.FreeBytes), path)
+	log.Printf("%s (requestID: %s)", message, requestID)
+
+	if s.diskSpacePolicy == DiskSpacePolicyRefuse {
+		// Direct downloads are cancelled by handleError
+		if record.URL == "" {
+			_, err := s.transmissionClient.StopTorrents(ctx, &transmission.StopTorrentsRequest{TorrentIds: []int64{record.TorrentID}})
+			if err != nil {
+				log.Printf("failed to stop torrent (requestID: %s): %v", requestID, err)
+			}
+		}
+		if err := s.handleError(ctx, requestID, statusResp, "❌ "+message); err != nil {
+			log.Printf("failed to handle error: %v", err)
+		}
+		return true
+	}
+
+	record.Warning = "⚠️ " + message
+	if err := s.redisClient.HSet(ctx, key, "warning", record.Warning).Err(); err != nil {
+		log.Printf("failed to save warning (requestID: %s): %v", requestID, err)
+	}
+
+	return false
+}
@@ -0,0 +1,143 @@
+package coordinator
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// S01E02, S01E02E03, S01E02-E05, S01E02-05
+	episodeRangePattern = regexp.MustCompile(`(?i)\bS(\d{1,2})[ ._-]?E(\d{1,3})((?:-?E\d{1,3}\b|-\d{1,3}\b|E\d{1,3})*)\b`)
+	// 1x02
+	episodeXPattern = regexp.MustCompile(`(?i)\b(\d{1,2})x(\d{2,3})\b`)
+	// Trailing episode numbers in a range (E03, -05)
+	episodeTailPattern = regexp.MustCompile(`(?i)E?(\d{1,3})`)
+	// Year in a release name, e.g. (2019) or .2019.
+	yearPattern = regexp.MustCompile(`[\(\[]?\b(19|20)\d{2}\b[\)\]]?`)
+	// Episode stored in SxxEyy form, episodes may have three digits
+	episodeKeyPattern = regexp.MustCompile(`^S(\d+)E(\d+)$`)
+	// Anything that is not a letter or a digit
+	nonAlnumPattern = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+)
+
+// Episode identifies a single episode of a show
+type Episode struct {
+	Season  int32
+	Episode int32
+}
+
+// String returns the episode in SxxEyy form
+func (e Episode) String() string {
+	return fmt.Sprintf("S%02dE%02d", e.Season, e.Episode)
+}
+
+// ParseEpisodeKey parses an episode stored in SxxEyy form
+func ParseEpisodeKey(key string) (Episode, error) {
+	m := episodeKeyPattern.FindStringSubmatch(key)
+	if m == nil {
+		return Episode{}, fmt.Errorf("invalid episode key %q", key)
+	}
+	return Episode{Season: atoi32(m[1]), Episode: atoi32(m[2])}, nil
+}
+
+// ParseRelease extracts the normalized show title and episodes from a torrent name.
+// It returns no episodes if the name does not contain an episode marker.
+func ParseRelease(name string) (string, []Episode) {
+	title, episodes := SplitRelease(name)
+	return NormalizeTitle(title), episodes
+}
+
+// SplitRelease splits a release name into the raw title before the episode marker and the episodes.
+// It returns the whole name and no episodes if the name does not contain an episode marker.
+func SplitRelease(name string) (string, []Episode) {
+	// Underscores are word characters for \b, read them as the separators they are; the length is kept
+	// so that indices still apply to name
+	matched := strings.ReplaceAll(name, "_", ".")
+
+	if loc := episodeRangePattern.FindStringSubmatchIndex(matched); loc != nil {
+		season := atoi32(name[loc[2]:loc[3]])
+		first := atoi32(name[loc[4]:loc[5]])
+		last := first
+		for _, m := range episodeTailPattern.FindAllStringSubmatch(name[loc[6]:loc[7]], -1) {
+			if n := atoi32(m[1]); n > last {
+				last = n
+			}
+		}
+
+		episodes := make([]Episode, 0, last-first+1)
+		for e := first; e <= last; e++ {
+			episodes = append(episodes, Episode{Season: season, Episode: e})
+		}
+		return name[:loc[0]], episodes
+	}
+
+	if loc := episodeXPattern.FindStringSubmatchIndex(matched); loc != nil {
+		episode := Episode{Season: atoi32(name[loc[2]:loc[3]]), Episode: atoi32(name[loc[4]:loc[5]])}
+		return name[:loc[0]], []Episode{episode}
+	}
+
+	return name, nil
+}
+
+// NormalizeTitle turns a show title or release name prefix into a comparable key.
+// Years are dropped, except at the start where they are the title itself, e.g. "1923".
+func NormalizeTitle(title string) string {
+	title = strings.TrimSpace(nonAlnumPattern.ReplaceAllString(strings.ToLower(title), " "))
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range yearPattern.FindAllStringIndex(title, -1) {
+		if loc[0] == 0 {
+			continue
+		}
+		b.WriteString(title[last:loc[0]])
+		b.WriteString(" ")
+		last = loc[1]
+	}
+	b.WriteString(title[last:])
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// MissingEpisodes returns the gaps in each season, from episode 1 up to the latest downloaded one
+func MissingEpisodes(downloaded []Episode) []Episode {
+	have := make(map[Episode]bool, len(downloaded))
+	latest := make(map[int32]int32)
+	for _, e := range downloaded {
+		have[e] = true
+		if e.Episode > latest[e.Season] {
+			latest[e.Season] = e.Episode
+		}
+	}
+
+	var missing []Episode
+	for season, last := range latest {
+		for n := int32(1); n < last; n++ {
+			e := Episode{Season: season, Episode: n}
+			if !have[e] {
+				missing = append(missing, e)
+			}
+		}
+	}
+
+	SortEpisodes(missing)
+	return missing
+}
+
+// SortEpisodes sorts episodes by season and episode number
+func SortEpisodes(episodes []Episode) {
+	slices.SortFunc(episodes, func(a, b Episode) int {
+		if a.Season != b.Season {
+			return int(a.Season - b.Season)
+		}
+		return int(a.Episode - b.Episode)
+	})
+}
+
+func atoi32(s string) int32 {
+	n, _ := strconv.ParseInt(s, 10, 32)
+	return int32(n)
+}
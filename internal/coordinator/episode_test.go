@@ -0,0 +1,87 @@
+package coordinator
+
+import (
+	"slices"
+	"testing"
+)
+
+// Releases are matched to the watchlist by the normalized title the show was added with
+func TestReleasesMatchWatchedShow(t *testing.T) {
+	tests := []struct {
+		show     string
+		release  string
+		episodes []Episode
+	}{
+		{"The Expanse", "The.Expanse.S03E05.1080p.WEB-DL.mkv", []Episode{{3, 5}}},
+		{"The Expanse", "the_expanse_S03E05E06_720p", []Episode{{3, 5}, {3, 6}}},
+		{"Doctor Who (2005)", "Doctor.Who.2005.S13E01-E03.HDTV", []Episode{{13, 1}, {13, 2}, {13, 3}}},
+		{"Doctor Who", "Doctor Who S13E08-10 WEB", []Episode{{13, 8}, {13, 9}, {13, 10}}},
+		{"1923", "1923.S01E01.2160p", []Episode{{1, 1}}},
+		{"One Piece", "One.Piece.S01E1071.1080p", nil},
+		{"One Piece", "One Piece S21E100", []Episode{{21, 100}}},
+		{"Show Name", "Show.Name.1x05.HDTV", []Episode{{1, 5}}},
+		{"Show Name", "Show_Name_1x05_HDTV", []Episode{{1, 5}}},
+	}
+
+	for _, tt := range tests {
+		title, episodes := ParseRelease(tt.release)
+		if tt.episodes == nil {
+			if len(episodes) > 0 {
+				t.Errorf("%s: episodes = %v, the episode number is out of range", tt.release, episodes)
+			}
+			continue
+		}
+
+		if key := NormalizeTitle(tt.show); title != key {
+			t.Errorf("%s: title %q doesn't match the watched show %q (%q)", tt.release, title, tt.show, key)
+		}
+		if !slices.Equal(episodes, tt.episodes) {
+			t.Errorf("%s: episodes = %v, want %v", tt.release, episodes, tt.episodes)
+		}
+	}
+}
+
+func TestReleaseWithoutEpisodes(t *testing.T) {
+	title, episodes := ParseRelease("Movie.Title.2019.1080p.BluRay")
+	if len(episodes) != 0 {
+		t.Errorf("episodes = %v, a movie has none", episodes)
+	}
+	if title != "movie title 1080p bluray" {
+		t.Errorf("title = %q", title)
+	}
+}
+
+// Downloaded episodes are stored as keys and read back to find the missing ones
+func TestEpisodeKeysRoundTrip(t *testing.T) {
+	downloaded := []Episode{{1, 1}, {1, 4}, {2, 2}, {1, 100}}
+
+	var parsed []Episode
+	for _, e := range downloaded {
+		key := e.String()
+		got, err := ParseEpisodeKey(key)
+		if err != nil {
+			t.Fatalf("ParseEpisodeKey(%q): %v", key, err)
+		}
+		if got != e {
+			t.Errorf("ParseEpisodeKey(%q) = %v, want %v", key, got, e)
+		}
+		parsed = append(parsed, got)
+	}
+
+	missing := MissingEpisodes(parsed)
+	if len(missing) != 97+1 {
+		t.Fatalf("missing = %d episodes, want 97 from season 1 and 1 from season 2", len(missing))
+	}
+	if missing[0] != (Episode{1, 2}) || missing[len(missing)-1] != (Episode{2, 1}) {
+		t.Errorf("missing = %v ... %v, want S01E02 ... S02E01", missing[0], missing[len(missing)-1])
+	}
+	if slices.Contains(missing, Episode{1, 4}) {
+		t.Error("a downloaded episode is reported missing")
+	}
+
+	for _, key := range []string{"s01e02", "S01", "S01E02 ", ""} {
+		if _, err := ParseEpisodeKey(key); err == nil {
+			t.Errorf("ParseEpisodeKey(%q) should fail", key)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+// finishingDownloads holds the completed downloads being finished in this coordinator
+type finishingDownloads struct {
+	mu       sync.Mutex
+	requests map[string]bool
+}
+
+// start marks a download as being finished, false if it already is
+func (f *finishingDownloads) start(requestID string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.requests[requestID] {
+		return false
+	}
+	if f.requests == nil {
+		f.requests = make(map[string]bool)
+	}
+	f.requests[requestID] = true
+	return true
+}
+
+func (f *finishingDownloads) done(requestID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.requests, requestID)
+}
+
+// startFinishing finishes a completed download in the background, unless it is already being finished
+func (s *Service) startFinishing(ctx context.Context, requestID string) {
+	if !s.finishing.start(requestID) {
+		return
+	}
+
+	go func() {
+		defer s.finishing.done(requestID)
+
+		if err := s.finishDownload(ctx, requestID); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("failed to finish download, retrying later (requestID: %s): %v", requestID, err)
+		}
+	}()
+}
+
+// ResumeFinishing finishes the completed downloads that aren't being finished, e.g. because the
+// coordinator stopped or finishing them failed. Downloads whose record is gone are dropped.
+func (s *Service) ResumeFinishing(ctx context.Context) {
+	requestIDs, err := s.redisClient.SMembers(ctx, KeyTorrentFinishing).Result()
+	if err != nil {
+		log.Printf("failed to get finishing downloads: %v", err)
+		return
+	}
+
+	for _, requestID := range requestIDs {
+		exists, err := s.redisClient.Exists(ctx, fmt.Sprintf(KeyTorrentFormat, requestID)).Result()
+		if err != nil {
+			continue
+		}
+		if exists == 0 {
+			s.redisClient.SRem(ctx, KeyTorrentFinishing, requestID)
+			continue
+		}
+
+		s.startFinishing(ctx, requestID)
+	}
+}
+
+// finishDownload extracts and imports a completed download, refreshes the media servers and waits for
+// them to pick it up, then sends the final update. The request leaves the finishing set only once the
+// final update was sent, which also saves it for the recovery service.
+func (s *Service) finishDownload(ctx context.Context, requestID string) error {
+	record, err := s.getTorrentRecord(ctx, requestID)
+	if err != nil {
+		log.Printf("failed to get torrent record: %v", err)
+		return err
+	}
+	name := record.Name
+
+	s.recordEpisodes(ctx, record.Category, name)
+
+	direct := record.URL != ""
+	if direct {
+		s.directDownloads.remove(requestID)
+	}
+
+	// Extract archives and organize files before Plex scans them
+	var extracted []string
+	warning := ""
+	if s.extractArchives && !direct {
+		extracted, err = s.extractDownload(ctx, requestID, record, name)
+		if err != nil {
+			log.Printf("failed to extract archives (requestID: %s): %v", requestID, err)
+			warning += fmt.Sprintf("\n⚠️ Archive extraction failed: %v", err)
+			s.appendHistory(ctx, requestID, "Extraction failed: "+err.Error())
+		}
+	}
+
+	imported, partial := false, false
+	// folder is scanned by the media servers, item is the downloaded folder or file they are asked to find
+	folder, item := "", ""
+	if s.importMode != ImportModeOff && !direct {
+		count, skipped, importFolder, err := s.importDownload(ctx, record, name, extracted, s.extractDir(record.Category, requestID))
+		if err != nil {
+			log.Printf("failed to import download (requestID: %s): %v", requestID, err)
+			warning += fmt.Sprintf("\n⚠️ Files were not organized: %v", err)
+			s.appendHistory(ctx, requestID, "Import failed: "+err.Error())
+		} else {
+			// Skipped files are still only in the torrent, it is kept so they are not deleted
+			imported, partial = len(skipped) == 0, len(skipped) > 0
+			folder, item = importFolder, importFolder
+			s.appendHistory(ctx, requestID, fmt.Sprintf("Imported %d files (%s)", count, s.importMode))
+			if len(skipped) > 0 {
+				warning += fmt.Sprintf("\n⚠️ %d files were not organized, a file already exists in the library: %s", len(skipped), strings.Join(skipped, ", "))
+				s.appendHistory(ctx, requestID, "Skipped existing files: "+strings.Join(skipped, ", "))
+			}
+		}
+	}
+
+	// Extracted files that weren't imported are made visible as extracted, the rest are left behind
+	if s.extractArchives && !direct && (imported || partial) {
+		if err := os.RemoveAll(s.extractDir(record.Category, requestID)); err != nil {
+			log.Printf("failed to remove extraction directory (requestID: %s): %v", requestID, err)
+		}
+	} else if s.extractArchives && !direct {
+		if err := s.publishExtracted(requestID, record.Category, extracted); err != nil {
+			log.Printf("failed to publish extracted files (requestID: %s): %v", requestID, err)
+			warning += fmt.Sprintf("\n⚠️ Extracted files were not moved into the library: %v", err)
+		}
+	}
+
+	if direct {
+		// Direct downloads are saved straight into the category directory
+		folder = s.pbTypeToDownloadPath[record.Category]
+		item = filepath.Join(folder, record.Name)
+	} else if s.importMode != ImportModeOff && folder == "" {
+		// The torrent is in the hidden staging directory Plex doesn't scan, only extracted files are visible
+		if len(extracted) > 0 {
+			folder = topLevelFolder(s.pbTypeToDownloadPath[record.Category], extracted[0])
+			item = topLevelPath(s.pbTypeToDownloadPath[record.Category], extracted[0])
+		}
+	} else if folder == "" {
+		if folder, item, err = s.downloadFolder(ctx, record); err != nil {
+			log.Printf("failed to get download folder, Plex will scan the whole section (requestID: %s): %v", requestID, err)
+		}
+	}
+
+	// Refresh media server libraries, only the downloaded folder if known
+	scanStartedAt := time.Now()
+	refreshed, refreshWarnings := s.refreshMediaServers(ctx, requestID, record.Category, folder)
+	refreshWarning := ""
+	for _, w := range refreshWarnings {
+		refreshWarning += "\n" + w
+	}
+	warning = refreshWarning + warning
+
+	// A failing server is only a warning as long as one of them refreshed its library
+	status, message := coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS, "✅ Download completed and library refreshed"+warning
+	if len(refreshed) == 0 {
+		status, message = coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR, "❌ Download completed, but no library was refreshed"+warning
+	}
+
+	if status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS && s.plexConfirmTimeout > 0 && item != "" {
+		// The final update is sent once the media servers have picked the item up
+		message = s.confirmInMediaServers(ctx, requestID, record.Category, item, refreshed, scanStartedAt, warning)
+	}
+	if ctx.Err() != nil {
+		// Stopping, the download is finished again on startup
+		return ctx.Err()
+	}
+
+	progressUpdate := &coordinatorpb.DownloadResponse{
+		RequestId: requestID,
+		Name:      name,
+		Status:    status,
+		Message:   message,
+		Progress:  100,
+	}
+
+	// Send final update to Redis
+	if err := s.sendProgressToRedis(ctx, progressUpdate); err != nil {
+		log.Printf("failed to send progress to Redis: %v", err)
+		return err
+	}
+
+	s.appendHistory(ctx, requestID, "Completed: "+strings.ReplaceAll(message, "\n", " "))
+
+	// Moved files can't be seeded, drop the torrent and its leftovers
+	if imported && s.importMode == ImportModeMove {
+		_, err := s.transmissionClient.RemoveTorrent(ctx, &transmission.RemoveTorrentRequest{
+			TorrentId:       record.TorrentID,
+			DeleteLocalData: true,
+		})
+		if err != nil {
+			log.Printf("failed to remove imported torrent (requestID: %s): %v", requestID, err)
+		} else {
+			s.appendHistory(ctx, requestID, "Removed from Transmission after import")
+		}
+	} else if partial && s.importMode == ImportModeMove {
+		// Part of the files were moved out, the torrent can't seed but still holds the skipped files
+		s.appendHistory(ctx, requestID, "Kept in Transmission, some files were not imported")
+	} else if status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS && !direct && s.startSeeding(ctx, requestID) {
+		// Keep the record while the torrent seeds according to its category's rule
+		return s.redisClient.SRem(ctx, KeyTorrentFinishing, requestID).Err()
+	}
+
+	// Clean up Redis
+	err = s.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentFormat, requestID)).Err()
+	if err != nil {
+		log.Printf("failed to delete torrent from Redis: %v", err)
+		return err
+	}
+
+	err = s.redisClient.SRem(ctx, KeyTorrentFinishing, requestID).Err()
+	if err != nil {
+		log.Printf("failed to remove torrent from Redis: %v", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// appendHistory records an event in the history of a download
+func (s *Service) appendHistory(ctx context.Context, requestID string, event string) {
+	key := fmt.Sprintf(KeyTorrentHistoryFormat, requestID)
+	entry := fmt.Sprintf("%d|%s", time.Now().Unix(), event)
+
+	if err := s.redisClient.RPush(ctx, key, entry).Err(); err != nil {
+		log.Printf("failed to append history (requestID: %s): %v", requestID, err)
+		return
+	}
+
+	if err := s.redisClient.Expire(ctx, key, HistoryTTL).Err(); err != nil {
+		log.Printf("failed to set history expiration (requestID: %s): %v", requestID, err)
+	}
+}
+
+func (s *Service) GetHistory(ctx context.Context, req *coordinatorpb.GetHistoryRequest) (*coordinatorpb.GetHistoryResponse, error) {
+	entries, err := s.redisClient.LRange(ctx, fmt.Sprintf(KeyTorrentHistoryFormat, req.RequestId), 0, -1).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get history from Redis: %v", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, status.Errorf(codes.NotFound, "no history for request %s", req.RequestId)
+	}
+
+	history := make([]*coordinatorpb.HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		timestamp, event, _ := strings.Cut(entry, "|")
+		unix, _ := strconv.ParseInt(timestamp, 10, 64)
+		history = append(history, &coordinatorpb.HistoryEntry{
+			Timestamp: unix,
+			Event:     event,
+		})
+	}
+
+	return &coordinatorpb.GetHistoryResponse{Entries: history}, nil
+}
@@ -0,0 +1,208 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// requestLockTTL bounds how long a crashed coordinator can hold the lock of a request
+	requestLockTTL = 2 * time.Minute
+	// requestLockWait is how long a duplicate request waits for the first one to finish
+	requestLockWait = 1 * time.Minute
+	// requestLockPollInterval is how often a waiting duplicate retries the lock
+	requestLockPollInterval = 200 * time.Millisecond
+	// requestLockRenewInterval is how often the lock of a request that is still being added is extended
+	requestLockRenewInterval = requestLockTTL / 3
+	// RequestResponseTTL is how long the response of an add request is returned for repeated requests
+	RequestResponseTTL = 24 * time.Hour
+)
+
+// releaseLockScript deletes a lock only if it is still held by the given token
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// renewLockScript extends a lock only if it is still held by the given token
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// addOnce runs an add request once per request ID: a repeated request gets the response of the first one,
+// and concurrent duplicates are serialized with a Redis lock. Failed requests are not saved, so they can be retried.
+func (s *Service) addOnce(ctx context.Context, requestID string, add func() (*coordinatorpb.DownloadResponse, error)) (*coordinatorpb.DownloadResponse, error) {
+	if requestID == "" {
+		return nil, status.Error(codes.InvalidArgument, "request_id is required")
+	}
+
+	if resp, err := s.savedResponse(ctx, requestID); err != nil || resp != nil {
+		return resp, err
+	}
+
+	lockKey := fmt.Sprintf(KeyRequestLockFormat, requestID)
+	token := uuid.New().String()
+	if err := s.acquireLock(ctx, lockKey, token); err != nil {
+		return nil, err
+	}
+	stopRenewing := s.renewLock(requestID, lockKey, token)
+	defer func() {
+		stopRenewing()
+		if err := releaseLockScript.Run(context.Background(), s.redisClient, []string{lockKey}, token).Err(); err != nil {
+			log.Printf("failed to release request lock (requestID: %s): %v", requestID, err)
+		}
+	}()
+
+	// The duplicate holding the lock may have just finished
+	if resp, err := s.savedResponse(ctx, requestID); err != nil || resp != nil {
+		return resp, err
+	}
+
+	resp, err := add()
+	if err != nil {
+		return nil, err
+	}
+
+	respBytes, err := proto.Marshal(resp)
+	if err == nil {
+		err = s.redisClient.Set(ctx, fmt.Sprintf(KeyRequestResponseFormat, requestID), respBytes, RequestResponseTTL).Err()
+	}
+	if err != nil {
+		log.Printf("failed to save response (requestID: %s): %v", requestID, err)
+	}
+
+	return resp, nil
+}
+
+// addTorrentOnce adds the torrent of a request to Transmission once. The added torrent is saved before the
+// request is tracked, so that a request retried after a later step failed reuses it instead of adding it again.
+func (s *Service) addTorrentOnce(ctx context.Context, requestID string, paused bool, add func(paused bool) (*transmission.AddTorrentResponse, error)) (*transmission.AddTorrentResponse, error) {
+	key := fmt.Sprintf(KeyRequestTorrentFormat, requestID)
+	data, err := s.redisClient.Get(ctx, key).Bytes()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, status.Errorf(codes.Internal, "failed to get added torrent from Redis: %v", err)
+	}
+
+	if err == nil {
+		response := &transmission.AddTorrentResponse{}
+		if err := proto.Unmarshal(data, response); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to unmarshal added torrent: %v", err)
+		}
+
+		log.Printf("Torrent already added, reusing it (requestID: %s, torrentID: %d)", requestID, response.TorrentId)
+		if !paused {
+			// The first attempt may have added it paused to wait in the queue
+			_, err := s.transmissionClient.StartTorrents(ctx, &transmission.StartTorrentsRequest{TorrentIds: []int64{response.TorrentId}})
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to start torrent: %v", err)
+			}
+		}
+		return response, nil
+	}
+
+	response, err := add(paused)
+	if err != nil {
+		log.Printf("Error occurred (requestID: %s): %v", requestID, err)
+		return nil, status.Errorf(codes.Internal, "failed to execute function: %v", err)
+	}
+
+	log.Printf("Torrent added (requestID: %s, torrentID: %d)", requestID, response.TorrentId)
+	s.appendHistory(ctx, requestID, fmt.Sprintf("Added to Transmission: %s (id: %d)", response.Name, response.TorrentId))
+
+	data, err = proto.Marshal(response)
+	if err == nil {
+		err = s.redisClient.Set(ctx, key, data, RequestResponseTTL).Err()
+	}
+	if err != nil {
+		log.Printf("failed to save added torrent (requestID: %s): %v", requestID, err)
+	}
+
+	return response, nil
+}
+
+// savedResponse returns the response of a request that was already handled, nil if there is none
+func (s *Service) savedResponse(ctx context.Context, requestID string) (*coordinatorpb.DownloadResponse, error) {
+	data, err := s.redisClient.Get(ctx, fmt.Sprintf(KeyRequestResponseFormat, requestID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get saved response from Redis: %v", err)
+	}
+
+	resp := &coordinatorpb.DownloadResponse{}
+	if err := proto.Unmarshal(data, resp); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to unmarshal saved response: %v", err)
+	}
+
+	log.Printf("Request already handled, returning its response (requestID: %s)", requestID)
+	return resp, nil
+}
+
+// acquireLock waits up to requestLockWait for the lock of a request
+func (s *Service) acquireLock(ctx context.Context, lockKey string, token string) error {
+	deadline := time.Now().Add(requestLockWait)
+	for {
+		acquired, err := s.redisClient.SetNX(ctx, lockKey, token, requestLockTTL).Result()
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to lock request in Redis: %v", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return status.Error(codes.Aborted, "the same request is still being handled")
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-time.After(requestLockPollInterval):
+		}
+	}
+}
+
+// renewLock keeps extending the lock of a request until the returned function is called, so that an add
+// outlasting requestLockTTL isn't run again by a duplicate
+func (s *Service) renewLock(requestID string, lockKey string, token string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(requestLockRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := renewLockScript.Run(context.Background(), s.redisClient, []string{lockKey}, token, requestLockTTL.Milliseconds()).Err()
+				if err != nil {
+					log.Printf("failed to renew request lock (requestID: %s): %v", requestID, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,277 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+// ImportMode defines how completed files are organized into the library
+type ImportMode string
+
+const (
+	// ImportModeOff leaves files where the torrent put them
+	ImportModeOff ImportMode = "off"
+	// ImportModeHardlink hardlinks files into the library, the torrent keeps seeding from the staging directory
+	ImportModeHardlink ImportMode = "hardlink"
+	// ImportModeMove moves files into the library and removes the torrent from Transmission
+	ImportModeMove ImportMode = "move"
+)
+
+// ImportStagingDir is the hidden subdirectory of a category directory torrents are downloaded to when
+// import is enabled, Plex skips hidden directories so only the organized files are scanned
+const ImportStagingDir = ".torrents"
+
+var (
+	videoExtensions    = []string{".mkv", ".mp4", ".avi", ".m4v", ".mov", ".wmv", ".ts", ".webm", ".mpg", ".mpeg"}
+	subtitleExtensions = []string{".srt", ".ass", ".ssa", ".sub", ".idx", ".vtt"}
+	// Sample files and folders, e.g. sample/, movie-sample.mkv
+	samplePattern = regexp.MustCompile(`(?i)(^|[/._ -])sample([/._ -]|$)`)
+	// Season marker of a season pack without episode numbers, e.g. Show.S01.1080p
+	seasonPattern = regexp.MustCompile(`(?i)\bS(\d{1,2})\b|\bseason[ ._-]?(\d{1,2})\b`)
+	// Episode number of a file in a season pack, e.g. E05.mkv or Episode 5.mkv
+	bareEpisodePattern = regexp.MustCompile(`(?i)\b(?:E|Ep|Episode)[ ._-]?(\d{1,3})\b`)
+)
+
+// ParseImportMode parses an import mode name, empty defaults to off
+func ParseImportMode(value string) (ImportMode, error) {
+	switch ImportMode(value) {
+	case "", ImportModeOff:
+		return ImportModeOff, nil
+	case ImportModeHardlink, ImportModeMove:
+		return ImportMode(value), nil
+	default:
+		return "", fmt.Errorf("unknown import mode %q, expected %q, %q or %q", value, ImportModeOff, ImportModeHardlink, ImportModeMove)
+	}
+}
+
+// downloadDir returns the directory Transmission downloads a category to
+func (s *Service) downloadDir(category common.RequestType) string {
+	path := s.pbTypeToDownloadPath[category]
+	if s.importMode == ImportModeOff {
+		return path
+	}
+	return filepath.Join(path, ImportStagingDir)
+}
+
+// downloadFolder returns the top-level folder of a torrent as seen by Transmission, or its download
+// directory for single-file torrents, and the path of its top-level folder or file
+func (s *Service) downloadFolder(ctx context.Context, record *TorrentRecord) (string, string, error) {
+	files, err := s.transmissionClient.GetTorrentFiles(ctx, &transmission.GetTorrentFilesRequest{TorrentId: record.TorrentID})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get torrent files: %w", err)
+	}
+
+	if len(files.Files) == 0 {
+		return files.DownloadDir, "", nil
+	}
+
+	return topLevelFolder(files.DownloadDir, files.Files[0].Name), topLevelPath(files.DownloadDir, files.Files[0].Name), nil
+}
+
+// topLevelFolder returns the first directory of a relative file path joined to root, or root if the file is at its top
+func topLevelFolder(root string, file string) string {
+	first, _, ok := strings.Cut(filepath.ToSlash(file), "/")
+	if !ok {
+		return root
+	}
+	return filepath.Join(root, first)
+}
+
+// topLevelPath returns the first element of a relative file path, a directory or the file itself, joined to root
+func topLevelPath(root string, file string) string {
+	first, _, _ := strings.Cut(filepath.ToSlash(file), "/")
+	return filepath.Join(root, first)
+}
+
+// importDownload organizes the media files of a completed torrent, including files extracted from
+// its archives into extractDir, into Plex naming conventions. It returns the number of imported files, the files
+// skipped because another file is already at their destination and the library folder they were
+// imported to, as seen by Transmission.
+func (s *Service) importDownload(ctx context.Context, record *TorrentRecord, name string, extracted []string, extractDir string) (int, []string, string, error) {
+	files, err := s.transmissionClient.GetTorrentFiles(ctx, &transmission.GetTorrentFilesRequest{TorrentId: record.TorrentID})
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("failed to get torrent files: %w", err)
+	}
+
+	candidates := slices.Clone(extracted)
+	for _, f := range files.Files {
+		candidates = append(candidates, f.Name)
+	}
+
+	var videos, subtitles []string
+	for _, f := range candidates {
+		if samplePattern.MatchString(f) {
+			continue
+		}
+
+		switch ext := strings.ToLower(filepath.Ext(f)); {
+		case slices.Contains(videoExtensions, ext):
+			videos = append(videos, f)
+		case slices.Contains(subtitleExtensions, ext):
+			subtitles = append(subtitles, f)
+		}
+	}
+
+	if len(videos) == 0 {
+		return 0, nil, "", errors.New("no video files found")
+	}
+
+	sourceDir := s.pathMapping.Apply(files.DownloadDir)
+	libraryDir := s.pathMapping.Apply(s.pbTypeToDownloadPath[record.Category])
+
+	// Destination path without extension of each video, keyed by its source path without extension
+	stems := make(map[string]string, len(videos))
+	imported := 0
+	var skipped []string
+	folder := ""
+
+	for _, video := range videos {
+		rel := s.importPath(record.Category, name, video, len(videos))
+		if folder == "" {
+			folder = topLevelFolder(s.pbTypeToDownloadPath[record.Category], rel)
+		}
+
+		dest := filepath.Join(libraryDir, rel)
+		ok, err := s.importFile(s.importSource(sourceDir, extractDir, video, extracted), dest, slices.Contains(extracted, video))
+		if err != nil {
+			return imported, skipped, folder, err
+		}
+		if !ok {
+			skipped = append(skipped, video)
+			continue
+		}
+
+		stems[strings.TrimSuffix(video, filepath.Ext(video))] = strings.TrimSuffix(dest, filepath.Ext(dest))
+		imported++
+	}
+
+	// Subtitles follow the video they are named after, e.g. Movie.en.srt next to Movie.mkv
+	for _, subtitle := range subtitles {
+		for source, dest := range stems {
+			if !strings.HasPrefix(subtitle, source+".") {
+				continue
+			}
+
+			ok, err := s.importFile(s.importSource(sourceDir, extractDir, subtitle, extracted), dest+strings.TrimPrefix(subtitle, source), slices.Contains(extracted, subtitle))
+			if err != nil {
+				return imported, skipped, folder, err
+			}
+			if ok {
+				imported++
+			} else {
+				skipped = append(skipped, subtitle)
+			}
+			break
+		}
+	}
+
+	log.Printf("Download imported (torrentID: %d, files: %d, skipped: %d, mode: %s)", record.TorrentID, imported, len(skipped), s.importMode)
+
+	return imported, skipped, folder, nil
+}
+
+// importSource returns the path of a file to import, extracted files are in the extraction directory
+func (s *Service) importSource(sourceDir string, extractDir string, file string, extracted []string) string {
+	if slices.Contains(extracted, file) {
+		return filepath.Join(extractDir, file)
+	}
+	return filepath.Join(sourceDir, file)
+}
+
+// importPath returns the library path of a video relative to the category directory
+func (s *Service) importPath(category common.RequestType, name string, file string, videos int) string {
+	base := filepath.Base(file)
+	ext := strings.ToLower(filepath.Ext(base))
+
+	if !isSeriesCategory(category) {
+		title := MovieTitle(name)
+		if videos > 1 {
+			return filepath.Join(title, base)
+		}
+		return filepath.Join(title, title+ext)
+	}
+
+	rawTitle, episodes := SplitRelease(strings.TrimSuffix(base, filepath.Ext(base)))
+	if len(episodes) == 0 && videos == 1 {
+		rawTitle, episodes = SplitRelease(name)
+	}
+
+	show := ShowTitle(rawTitle)
+	if len(episodes) == 0 || show == "" {
+		// Season packs name files by episode only, take the show from the torrent name
+		torrentTitle, _ := SplitRelease(name)
+		if loc := seasonPattern.FindStringSubmatchIndex(torrentTitle); loc != nil {
+			if len(episodes) == 0 {
+				episodes = seasonPackEpisode(torrentTitle, loc, base)
+			}
+			torrentTitle = torrentTitle[:loc[0]]
+		}
+		show = ShowTitle(torrentTitle)
+	}
+
+	if len(episodes) == 0 {
+		return filepath.Join(show, base)
+	}
+
+	season := fmt.Sprintf("Season %02d", episodes[0].Season)
+	return filepath.Join(show, season, EpisodeFileName(show, episodes)+ext)
+}
+
+// importFile hardlinks or moves a file and reports whether the file is in the library. Existing
+// destinations are left untouched, the file counts as imported only if it is already the destination
+// (a hardlink or a move from an earlier attempt). Extracted files are not seeded, so they are always moved.
+func (s *Service) importFile(source string, dest string, extracted bool) (bool, error) {
+	if destInfo, err := os.Stat(dest); err == nil {
+		sourceInfo, err := os.Stat(source)
+		if err != nil && errors.Is(err, os.ErrNotExist) || err == nil && os.SameFile(sourceInfo, destInfo) {
+			return true, nil
+		}
+
+		log.Printf("import destination already exists, skipping: %s", dest)
+		return false, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	switch {
+	case s.importMode == ImportModeHardlink && !extracted:
+		if err := os.Link(source, dest); err != nil {
+			return false, fmt.Errorf("failed to hardlink %s: %w", filepath.Base(source), err)
+		}
+	default:
+		if err := os.Rename(source, dest); err != nil {
+			return false, fmt.Errorf("failed to move %s: %w", filepath.Base(source), err)
+		}
+	}
+
+	return true, nil
+}
+
+// seasonPackEpisode combines the season marker of a torrent name with a bare episode number in a file name
+func seasonPackEpisode(torrentTitle string, seasonLoc []int, file string) []Episode {
+	m := bareEpisodePattern.FindStringSubmatch(file)
+	if m == nil {
+		return nil
+	}
+
+	season := ""
+	if seasonLoc[2] >= 0 {
+		season = torrentTitle[seasonLoc[2]:seasonLoc[3]]
+	} else {
+		season = torrentTitle[seasonLoc[4]:seasonLoc[5]]
+	}
+
+	return []Episode{{Season: atoi32(season), Episode: atoi32(m[1])}}
+}
@@ -0,0 +1,124 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/plex"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// plexClockSkew allows for a media server clock running behind the coordinator's
+	plexClockSkew = 1 * time.Minute
+)
+
+// mediaServer is a media server service endpoint implementing the Plex service contract
+type mediaServer struct {
+	name   string
+	client plex.PlexServiceClient
+}
+
+// refreshMediaServers asks every media server to scan the downloaded folder. It returns the servers
+// that refreshed their library and a warning for each one that failed.
+func (s *Service) refreshMediaServers(ctx context.Context, requestID string, category common.RequestType, folder string) ([]mediaServer, []string) {
+	req := &plex.UpdateCategoryRequest{
+		RequestId: requestID,
+		Type:      category,
+		Path:      folder,
+	}
+
+	errs := make([]error, len(s.mediaServers))
+	var wg sync.WaitGroup
+	for i, server := range s.mediaServers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp, err := server.client.UpdateCategory(ctx, req)
+			switch {
+			case err != nil:
+				errs[i] = fmt.Errorf("%s", status.Convert(err).Message())
+			case resp.Result != plex.ResponseResult_RESPONSE_RESULT_SUCCESS:
+				errs[i] = fmt.Errorf("%s", resp.Message)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var refreshed []mediaServer
+	var warnings []string
+	for i, server := range s.mediaServers {
+		if errs[i] != nil {
+			log.Printf("failed to refresh media server library (requestID: %s, server: %s): %v", requestID, server.name, errs[i])
+			warnings = append(warnings, fmt.Sprintf("⚠️ Failed to refresh %s: %v", server.name, errs[i]))
+			continue
+		}
+		refreshed = append(refreshed, server)
+	}
+
+	return refreshed, warnings
+}
+
+// confirmInMediaServers waits for the downloaded folder or file to appear in the refreshed media servers and
+// returns the final message, linking to the item or warning about the servers that didn't pick it up
+func (s *Service) confirmInMediaServers(ctx context.Context, requestID string, category common.RequestType, item string, servers []mediaServer, scanStartedAt time.Time, warning string) string {
+	ctx, cancel := context.WithTimeout(ctx, s.plexConfirmTimeout+30*time.Second)
+	defer cancel()
+
+	req := &plex.FindItemRequest{
+		RequestId:      requestID,
+		Type:           category,
+		Path:           item,
+		AddedSince:     scanStartedAt.Add(-plexClockSkew).Unix(),
+		TimeoutSeconds: int32(s.plexConfirmTimeout.Seconds()),
+	}
+
+	responses := make([]*plex.FindItemResponse, len(servers))
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i], errs[i] = server.client.FindItem(ctx, req)
+		}()
+	}
+	wg.Wait()
+
+	title := ""
+	var links, warnings []string
+	for i, server := range servers {
+		resp, err := responses[i], errs[i]
+		switch {
+		case err != nil:
+			log.Printf("failed to find item in media server (requestID: %s, server: %s): %v", requestID, server.name, err)
+			warnings = append(warnings, fmt.Sprintf("⚠️ Couldn't check %s: %s", server.name, status.Convert(err).Message()))
+		case !resp.Found:
+			warnings = append(warnings, fmt.Sprintf("⚠️ %s didn't pick it up within %s", server.name, s.plexConfirmTimeout))
+		default:
+			if title == "" {
+				title = resp.Title
+				if resp.Year > 0 {
+					title = fmt.Sprintf("%s (%d)", title, resp.Year)
+				}
+			}
+			if resp.Url != "" {
+				links = append(links, "🔗 "+resp.Url)
+			}
+		}
+	}
+
+	message := "✅ Download completed and library refreshed"
+	if title != "" {
+		message = "✅ Download completed and added to the library: " + title
+	}
+	for _, line := range append(links, warnings...) {
+		message += "\n" + line
+	}
+	return message + warning
+}
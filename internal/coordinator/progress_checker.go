@@ -4,14 +4,12 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"math"
 	"strconv"
 	"time"
 
-	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
 	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
-	"github.com/aquare11e/media-downloader-bot/common/protogen/plex"
 	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
@@ -21,53 +19,100 @@ const (
 	checkInterval = 1 * time.Minute
 )
 
+// StartProgressCheckerService checks every in progress download on its own schedule and seeding
+// torrents every checkInterval. New downloads are picked up as soon as wakeProgressChecker is called.
 func (s *Service) StartProgressCheckerService(ctx context.Context) {
 	log.Printf("Starting progress checker service")
 
-	ticker := time.NewTicker(checkInterval)
-	defer ticker.Stop()
+	schedule := progressSchedule{}
+	var seedingCheckedAt time.Time
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			log.Printf("Progress checker service stopped")
 			return
-		case <-ticker.C:
-			for {
-				waitTime := s.checkProgress(ctx)
-				if waitTime != nil && *waitTime < checkInterval {
-					time.Sleep(*waitTime)
-				} else {
-					break
-				}
+		case <-s.progressWake:
+		case <-timer.C:
+		}
+
+		if time.Since(seedingCheckedAt) >= checkInterval {
+			s.checkSeeding(ctx)
+			seedingCheckedAt = time.Now()
+		}
+
+		s.checkProgress(ctx, schedule)
+
+		next := seedingCheckedAt.Add(checkInterval)
+		if check := schedule.next(); !check.IsZero() && check.Before(next) {
+			next = check
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
 			}
 		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// wakeProgressChecker makes the progress checker look for new downloads now instead of at its next check
+func (s *Service) wakeProgressChecker() {
+	select {
+	case s.progressWake <- struct{}{}:
+	default:
 	}
 }
 
-func (s *Service) checkProgress(ctx context.Context) *time.Duration {
+// checkProgress checks the downloads that are due and schedules their next check
+func (s *Service) checkProgress(ctx context.Context, schedule progressSchedule) {
+	// Finished downloads free up slots for queued ones
+	defer s.promoteQueued(ctx)
+
 	requestIDs, err := s.redisClient.SMembers(ctx, KeyTorrentInProgress).Result()
 	if err != nil {
 		log.Printf("failed to get torrent IDs: %v", err)
-		return nil
+		return
 	}
 
+	now := time.Now()
+	requestIDs = schedule.due(requestIDs, now)
 	if len(requestIDs) == 0 {
-		return nil
+		return
 	}
 
-	minEta := int32(math.MaxInt32)
+	records, statuses, err := s.getTorrentsStatus(ctx, requestIDs)
+	if err != nil {
+		log.Printf("failed to get torrents status: %v", err)
+		for _, requestID := range requestIDs {
+			schedule.update(requestID, nil, now)
+		}
+		return
+	}
+
+	s.touchRecords(ctx, statuses, now)
 
 	for _, requestID := range requestIDs {
-		statusResp, err := s.getTorrentStatus(ctx, requestID)
-		if err != nil {
-			if status.Code(err) == codes.NotFound {
-				log.Printf("torrent not found, stopping for that request (requestID: %s): %v", requestID, err)
-				s.handleTorrentNotFound(ctx, requestID)
-				continue
-			}
+		if ctx.Err() != nil {
+			return
+		}
 
-			log.Printf("failed to get torrent status (requestID: %s): %v", requestID, err)
+		record, ok := records[requestID]
+		if !ok {
+			// Left to the recovery service
+			continue
+		}
+
+		statusResp, ok := statuses[requestID]
+		schedule.update(requestID, statusResp, now)
+		if !ok {
+			log.Printf("torrent not found, stopping for that request (requestID: %s, torrentID: %d)", requestID, record.TorrentID)
+			s.handleTorrentNotFound(ctx, requestID)
 			continue
 		}
 
@@ -75,20 +120,33 @@ func (s *Service) checkProgress(ctx context.Context) *time.Duration {
 		switch statusResp.Status {
 		case transmission.TorrentStatus_STATUS_ERROR:
 			log.Printf("torrent status is error, check transmission's download: %s", statusResp.Name)
-			err := s.handleError(ctx, requestID, statusResp.Name, "❌ Download failed")
+			err := s.handleError(ctx, requestID, statusResp, "❌ Download failed")
 			if err != nil {
 				log.Printf("failed to handle error: %v", err)
 			}
 
 		case transmission.TorrentStatus_STATUS_STOPPED:
+			// A complete torrent may be stopped right away by the seed limit, it still needs the library refresh
+			if statusResp.State == transmission.TorrentState_STATE_FINISHED {
+				log.Printf("torrent finished and stopped, check plex's library: %s", statusResp.Name)
+				if err := s.handleDone(ctx, requestID, statusResp.Name); err != nil {
+					log.Printf("failed to handle done: %v", err)
+				}
+				break
+			}
+
 			log.Printf("torrent status is stopped, check transmission's download: %s", statusResp.Name)
-			err := s.handleError(ctx, requestID, statusResp.Name, "❌ Download stopped")
+			err := s.handleError(ctx, requestID, statusResp, "❌ Download stopped")
 			if err != nil {
 				log.Printf("failed to handle error: %v", err)
 			}
 
 		case transmission.TorrentStatus_STATUS_IN_PROGRESS:
-			err := s.handleInProgress(ctx, requestID, statusResp.Name, statusResp.Progress, statusResp.Eta)
+			if s.checkDiskSpace(ctx, requestID, record, statusResp) {
+				break
+			}
+
+			err := s.handleTorrentProgress(ctx, requestID, statusResp, record.Warning)
 			if err != nil {
 				log.Printf("failed to handle in progress: %v", err)
 			}
@@ -100,51 +158,75 @@ func (s *Service) checkProgress(ctx context.Context) *time.Duration {
 				log.Printf("failed to handle done: %v", err)
 			}
 		}
-
-		if statusResp.Eta > 0 && statusResp.Eta < minEta {
-			minEta = statusResp.Eta
-		}
 	}
+}
 
-	if minEta == math.MaxInt32 {
-		return nil
+// touchRecords marks the records of the downloads whose status was read as updated, for the recovery service.
+// It runs before the downloads are handled, so that records removed on completion aren't recreated.
+func (s *Service) touchRecords(ctx context.Context, statuses map[string]*transmission.GetTorrentStatusResponse, now time.Time) {
+	if len(statuses) == 0 {
+		return
 	}
 
-	waitTime := time.Duration(minEta)*time.Second + EtaErrorSeconds*time.Second
-	return &waitTime
+	pipe := s.redisClient.Pipeline()
+	for requestID := range statuses {
+		pipe.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), "updated_at", now.Unix())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("failed to mark torrent records as updated: %v", err)
+	}
 }
 
-func (s *Service) getTorrentStatus(ctx context.Context, requestID string) (*transmission.GetTorrentStatusResponse, error) {
-	torrentID, err := s.redisClient.HGet(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), "torrent_id").Result()
+// getTorrentsStatus reads the records of many requests and the status of their torrents in a constant
+// number of round trips. Requests without a record are left out of both maps, requests whose torrent
+// wasn't found are left out of the statuses.
+func (s *Service) getTorrentsStatus(ctx context.Context, requestIDs []string) (map[string]*TorrentRecord, map[string]*transmission.GetTorrentStatusResponse, error) {
+	records, err := s.getTorrentRecords(ctx, requestIDs)
 	if err != nil {
-		log.Printf("failed to get torrent ID: %v", err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	torrentIDInt, err := strconv.ParseInt(torrentID, 10, 64)
-	if err != nil {
-		log.Printf("failed to parse torrent ID: %v", err)
-		return nil, err
+	statuses := make(map[string]*transmission.GetTorrentStatusResponse, len(records))
+	// Several requests can track the same torrent, e.g. the same magnet added twice
+	requestIDsByTorrent := make(map[int64][]string, len(records))
+	torrentIDs := make([]int64, 0, len(records))
+	for requestID, record := range records {
+		if record.URL != "" {
+			if statusResp, err := s.directDownloadStatus(requestID, record); err == nil {
+				statuses[requestID] = statusResp
+			}
+			continue
+		}
+
+		if _, ok := requestIDsByTorrent[record.TorrentID]; !ok {
+			torrentIDs = append(torrentIDs, record.TorrentID)
+		}
+		requestIDsByTorrent[record.TorrentID] = append(requestIDsByTorrent[record.TorrentID], requestID)
 	}
 
-	// Get torrent status
-	statusReq := &transmission.GetTorrentStatusRequest{
-		TorrentId: torrentIDInt,
-		RequestId: requestID,
+	if len(torrentIDs) == 0 {
+		return records, statuses, nil
 	}
 
-	statusResp, err := s.transmissionClient.GetTorrentStatus(ctx, statusReq)
+	resp, err := s.transmissionClient.GetTorrentsStatus(ctx, &transmission.GetTorrentsStatusRequest{TorrentIds: torrentIDs})
 	if err != nil {
-		log.Printf("failed to get torrent status (id: %d): %v", torrentIDInt, err)
-		return nil, err
+		return nil, nil, fmt.Errorf("failed to get torrents status (ids: %v): %w", torrentIDs, err)
+	}
+
+	for _, statusResp := range resp.Torrents {
+		for _, requestID := range requestIDsByTorrent[statusResp.TorrentId] {
+			statuses[requestID] = statusResp
+		}
 	}
 
-	return statusResp, nil
+	return records, statuses, nil
 }
 
 func (s *Service) handleTorrentNotFound(ctx context.Context, requestID string) {
+	s.directDownloads.remove(requestID)
 	s.redisClient.SRem(ctx, KeyTorrentInProgress, requestID)
 	s.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentFormat, requestID))
+	s.appendHistory(ctx, requestID, "Lost: torrent is no longer in Transmission")
 
 	s.sendProgressToRedis(ctx, &coordinatorpb.DownloadResponse{
 		RequestId: requestID,
@@ -153,16 +235,21 @@ func (s *Service) handleTorrentNotFound(ctx context.Context, requestID string) {
 	})
 }
 
-func (s *Service) handleError(ctx context.Context, requestID string, name string, message string) error {
+func (s *Service) handleError(ctx context.Context, requestID string, statusResp *transmission.GetTorrentStatusResponse, message string) error {
+	event := "Failed: " + message
+	if statusResp.ErrorString != "" {
+		event += " (" + statusResp.ErrorString + ")"
+	}
+
+	s.appendHistory(ctx, requestID, event)
+	s.directDownloads.remove(requestID)
 	s.redisClient.SRem(ctx, KeyTorrentInProgress, requestID)
 	s.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentFormat, requestID))
 
-	progressUpdate := &coordinatorpb.DownloadResponse{
-		RequestId: requestID,
-		Name:      name,
-		Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR,
-		Message:   message,
-	}
+	progressUpdate := transferDetails(statusResp)
+	progressUpdate.RequestId = requestID
+	progressUpdate.Status = coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR
+	progressUpdate.Message = message
 
 	if err := s.sendProgressToRedis(ctx, progressUpdate); err != nil {
 		log.Printf("failed to send progress to Redis: %v", err)
@@ -172,11 +259,12 @@ func (s *Service) handleError(ctx context.Context, requestID string, name string
 	return nil
 }
 
-func (s *Service) handleInProgress(ctx context.Context, requestID string, name string, progress float64, eta int32) error {
+func (s *Service) handleInProgress(ctx context.Context, requestID string, name string, progress float64, eta int32, message string) error {
 	progressUpdate := &coordinatorpb.DownloadResponse{
 		RequestId: requestID,
 		Name:      name,
 		Progress:  progress,
+		Message:   message,
 	}
 
 	if eta > 0 {
@@ -186,83 +274,82 @@ func (s *Service) handleInProgress(ctx context.Context, requestID string, name s
 	return s.sendProgressToRedis(ctx, progressUpdate)
 }
 
-func (s *Service) handleDone(ctx context.Context, requestID string, name string) error {
-	category, err := s.redisClient.HGet(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), "category").Result()
-	if err != nil {
-		log.Printf("failed to get torrent category: %v", err)
-		return err
-	}
-
-	categoryInt, err := strconv.ParseInt(category, 10, 32)
-	if err != nil {
-		log.Printf("failed to parse torrent category: %v", err)
-		return err
-	}
-
-	// Refresh Plex library
-	plexReq := &plex.UpdateCategoryRequest{
-		RequestId: requestID,
-		Type:      common.RequestType(categoryInt),
-	}
-
-	var status coordinatorpb.DownloadStatus
-	var message string
+// handleTorrentProgress reports a running download with its transfer details
+func (s *Service) handleTorrentProgress(ctx context.Context, requestID string, statusResp *transmission.GetTorrentStatusResponse, message string) error {
+	progressUpdate := transferDetails(statusResp)
+	progressUpdate.RequestId = requestID
+	progressUpdate.Message = message
 
-	plexResp, err := s.plexClient.UpdateCategory(ctx, plexReq)
-	if err != nil {
-		status, message = coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR, fmt.Sprintf("Failed to refresh Plex library: %v", err)
-	} else if plexResp.Result == plex.ResponseResult_RESPONSE_RESULT_SUCCESS {
-		status, message = coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS, "✅ Download completed and library refreshed"
-	} else {
-		status, message = coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR, plexResp.Message
-	}
+	return s.sendProgressToRedis(ctx, progressUpdate)
+}
 
+// transferDetails copies the transfer details of a torrent status into a progress update
+func transferDetails(statusResp *transmission.GetTorrentStatusResponse) *coordinatorpb.DownloadResponse {
 	progressUpdate := &coordinatorpb.DownloadResponse{
-		RequestId: requestID,
-		Name:      name,
-		Status:    status,
-		Message:   message,
-		Progress:  100,
+		Name:               statusResp.Name,
+		Progress:           statusResp.Progress,
+		SizeBytes:          statusResp.SizeBytes,
+		DownloadedBytes:    statusResp.DownloadedBytes,
+		UploadedBytes:      statusResp.UploadedBytes,
+		UploadRatio:        statusResp.UploadRatio,
+		DownloadRate:       statusResp.DownloadRate,
+		UploadRate:         statusResp.UploadRate,
+		PeersConnected:     statusResp.PeersConnected,
+		PeersSendingToUs:   statusResp.PeersSendingToUs,
+		PeersGettingFromUs: statusResp.PeersGettingFromUs,
+		TrackerStatus:      statusResp.TrackerStatus,
+		ErrorString:        statusResp.ErrorString,
 	}
 
-	// Send final update to Redis
-	if err := s.sendProgressToRedis(ctx, progressUpdate); err != nil {
-		log.Printf("failed to send progress to Redis: %v", err)
-		return err
+	if statusResp.Eta > 0 {
+		progressUpdate.Eta = statusResp.Eta
 	}
 
-	// Clean up Redis
-	err = s.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentFormat, requestID)).Err()
-	if err != nil {
-		log.Printf("failed to delete torrent from Redis: %v", err)
-		return err
-	}
+	return progressUpdate
+}
 
-	err = s.redisClient.SRem(ctx, KeyTorrentInProgress, requestID).Err()
+// handleDone hands a completed download over to finishDownload, which extracts, imports and refreshes
+// the libraries off the progress checker loop. The request moves to the finishing set so that the
+// checker leaves it and it is finished again if the coordinator stops before the final update.
+func (s *Service) handleDone(ctx context.Context, requestID string, name string) error {
+	_, err := s.redisClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), "name", name)
+		pipe.SMove(ctx, KeyTorrentInProgress, KeyTorrentFinishing, requestID)
+		return nil
+	})
 	if err != nil {
-		log.Printf("failed to remove torrent from Redis: %v", err)
-		return err
+		return fmt.Errorf("failed to mark download as finishing: %w", err)
 	}
 
+	s.startFinishing(ctx, requestID)
 	return nil
 }
 
 func (s *Service) sendProgressToRedis(ctx context.Context, progress *coordinatorpb.DownloadResponse) error {
+	progress.Requester = s.requester(ctx, progress.RequestId)
+
 	progressBytes, err := proto.Marshal(progress)
 	if err != nil {
 		return status.Errorf(codes.Internal, "failed to marshal progress update: %v", err)
 	}
 
-	// Push to Redis queue
-	err = s.redisClient.RPush(ctx, KeyDownloadProgress, progressBytes).Err()
-	if err != nil {
-		return status.Errorf(codes.Internal, "failed to push progress update to Redis: %v", err)
+	// Keep final updates, the recovery service sends them again if the bot missed them
+	if progress.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SUCCESS || progress.Status == coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR {
+		err = s.redisClient.Set(ctx, fmt.Sprintf(KeyTorrentFinalFormat, progress.RequestId), progressBytes, HistoryTTL).Err()
+		if err != nil {
+			log.Printf("failed to save final progress update (requestID: %s): %v", progress.RequestId, err)
+		}
 	}
 
-	// Set expiration for the queue (e.g., 24 hours)
-	err = s.redisClient.Expire(ctx, KeyDownloadProgress, 24*time.Hour).Err()
+	// Append to the stream, trimming updates older than the retention instead of expiring the whole stream
+	err = s.redisClient.XAdd(ctx, &redis.XAddArgs{
+		Stream: KeyDownloadEvents,
+		MinID:  strconv.FormatInt(time.Now().Add(-DownloadEventsRetention).UnixMilli(), 10),
+		Approx: true,
+		Values: map[string]any{"data": progressBytes},
+	}).Err()
 	if err != nil {
-		return status.Errorf(codes.Internal, "failed to set queue expiration: %v", err)
+		return status.Errorf(codes.Internal, "failed to add progress update to Redis stream: %v", err)
 	}
 
 	return nil
@@ -0,0 +1,99 @@
+package coordinator
+
+import (
+	"time"
+
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+const (
+	// minCheckDelay keeps downloads about to finish from being polled in a tight loop
+	minCheckDelay = 5 * time.Second
+	// maxCheckBackoff is the longest delay between checks of a stalled or queued download,
+	// it stays below StaleThreshold so that stalled downloads are not expired
+	maxCheckBackoff = 5 * time.Minute
+)
+
+// progressCheck is when a download is checked next
+type progressCheck struct {
+	next time.Time
+	// backoff is the current delay of a stalled download, doubled on every check without progress
+	backoff time.Duration
+}
+
+// progressSchedule tracks the next check of every in progress download, it is owned by the progress checker
+type progressSchedule map[string]*progressCheck
+
+// due returns the downloads to check now, downloads not seen before are due right away and
+// downloads no longer in progress are forgotten
+func (ps progressSchedule) due(requestIDs []string, now time.Time) []string {
+	inProgress := make(map[string]bool, len(requestIDs))
+	var due []string
+	for _, requestID := range requestIDs {
+		inProgress[requestID] = true
+
+		check, ok := ps[requestID]
+		if !ok || !check.next.After(now) {
+			due = append(due, requestID)
+		}
+	}
+
+	for requestID := range ps {
+		if !inProgress[requestID] {
+			delete(ps, requestID)
+		}
+	}
+
+	return due
+}
+
+// next returns the time of the earliest check, the zero time if nothing is scheduled
+func (ps progressSchedule) next() time.Time {
+	var next time.Time
+	for _, check := range ps {
+		if next.IsZero() || check.next.Before(next) {
+			next = check.next
+		}
+	}
+	return next
+}
+
+// update schedules the next check of a download after its status: shortly after its ETA if it finishes
+// before the regular interval, with a growing backoff while it is stalled or waiting in the client
+func (ps progressSchedule) update(requestID string, statusResp *transmission.GetTorrentStatusResponse, now time.Time) {
+	check, ok := ps[requestID]
+	if !ok {
+		check = &progressCheck{}
+		ps[requestID] = check
+	}
+
+	delay := checkInterval
+	switch {
+	case statusResp == nil || statusResp.Status != transmission.TorrentStatus_STATUS_IN_PROGRESS:
+		// Finished or failed downloads leave the in progress set, a failed handling is retried
+		check.backoff = 0
+
+	case isStalled(statusResp):
+		check.backoff = min(max(2*check.backoff, checkInterval), maxCheckBackoff)
+		delay = check.backoff
+
+	default:
+		check.backoff = 0
+		if statusResp.Eta > 0 {
+			eta := time.Duration(statusResp.Eta)*time.Second + EtaErrorSeconds*time.Second
+			delay = min(max(eta, minCheckDelay), checkInterval)
+		}
+	}
+
+	check.next = now.Add(delay)
+}
+
+// isStalled reports downloads that won't make progress soon: queued, verifying, fetching metadata or
+// without peers sending data
+func isStalled(statusResp *transmission.GetTorrentStatusResponse) bool {
+	switch statusResp.State {
+	case transmission.TorrentState_STATE_QUEUED, transmission.TorrentState_STATE_VERIFYING, transmission.TorrentState_STATE_METADATA:
+		return true
+	}
+	return statusResp.DownloadRate == 0
+}
@@ -0,0 +1,97 @@
+package coordinator
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+func TestProgressScheduleUpdate(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	downloading := func(eta int32, rate int32) *transmission.GetTorrentStatusResponse {
+		return &transmission.GetTorrentStatusResponse{
+			Status:       transmission.TorrentStatus_STATUS_IN_PROGRESS,
+			State:        transmission.TorrentState_STATE_DOWNLOADING,
+			Eta:          eta,
+			DownloadRate: rate,
+		}
+	}
+
+	tests := []struct {
+		name        string
+		backoff     time.Duration
+		status      *transmission.GetTorrentStatusResponse
+		wantDelay   time.Duration
+		wantBackoff time.Duration
+	}{
+		{name: "no status", backoff: time.Minute, wantDelay: checkInterval},
+		{
+			name:      "done",
+			backoff:   time.Minute,
+			status:    &transmission.GetTorrentStatusResponse{Status: transmission.TorrentStatus_STATUS_DONE},
+			wantDelay: checkInterval,
+		},
+		{name: "finishes soon", status: downloading(20, 1000), wantDelay: 30 * time.Second},
+		{name: "finishes now", status: downloading(1, 1000), wantDelay: 11 * time.Second},
+		{name: "finishes later", status: downloading(3600, 1000), wantDelay: checkInterval},
+		{name: "unknown eta", status: downloading(-1, 1000), wantDelay: checkInterval},
+		{name: "progress resets backoff", backoff: 4 * time.Minute, status: downloading(3600, 1000), wantDelay: checkInterval},
+		{name: "first stall", status: downloading(-1, 0), wantDelay: checkInterval, wantBackoff: checkInterval},
+		{name: "stall doubles backoff", backoff: 2 * time.Minute, status: downloading(-1, 0), wantDelay: 4 * time.Minute, wantBackoff: 4 * time.Minute},
+		{name: "stall backoff is capped", backoff: 4 * time.Minute, status: downloading(-1, 0), wantDelay: maxCheckBackoff, wantBackoff: maxCheckBackoff},
+		{
+			name:    "queued with rate",
+			backoff: time.Minute,
+			status: &transmission.GetTorrentStatusResponse{
+				Status:       transmission.TorrentStatus_STATUS_IN_PROGRESS,
+				State:        transmission.TorrentState_STATE_QUEUED,
+				DownloadRate: 1000,
+			},
+			wantDelay:   2 * time.Minute,
+			wantBackoff: 2 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := progressSchedule{"request": {backoff: tt.backoff}}
+			ps.update("request", tt.status, now)
+
+			check := ps["request"]
+			if delay := check.next.Sub(now); delay != tt.wantDelay {
+				t.Errorf("delay = %v, want %v", delay, tt.wantDelay)
+			}
+			if check.backoff != tt.wantBackoff {
+				t.Errorf("backoff = %v, want %v", check.backoff, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+func TestProgressScheduleDue(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ps := progressSchedule{
+		"waiting":  {next: now.Add(time.Minute)},
+		"due":      {next: now},
+		"finished": {next: now.Add(-time.Minute)},
+	}
+
+	// A download not seen before is due right away, a download no longer in progress is forgotten
+	due := ps.due([]string{"waiting", "due", "new"}, now)
+	slices.Sort(due)
+	if !slices.Equal(due, []string{"due", "new"}) {
+		t.Errorf("due() = %v, want [due new]", due)
+	}
+	if _, ok := ps["finished"]; ok {
+		t.Error("finished download is still scheduled")
+	}
+
+	if next := ps.next(); !next.Equal(now) {
+		t.Errorf("next() = %v, want %v", next, now)
+	}
+	if next := (progressSchedule{}).next(); !next.IsZero() {
+		t.Errorf("next() = %v with nothing scheduled, want the zero time", next)
+	}
+}
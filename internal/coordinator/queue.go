@@ -0,0 +1,238 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// queueScore orders the queue by priority (highest first), then by enqueue time (oldest first)
+func queueScore(priority coordinatorpb.DownloadPriority, queuedAt int64) float64 {
+	return float64(-int64(normalizePriority(priority))*1e10 + queuedAt)
+}
+
+func normalizePriority(priority coordinatorpb.DownloadPriority) coordinatorpb.DownloadPriority {
+	if priority == coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_UNSPECIFIED {
+		return coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_NORMAL
+	}
+	return priority
+}
+
+// queueEnabled reports whether any active download limit is configured
+func (s *Service) queueEnabled() bool {
+	if s.maxActiveDownloads > 0 {
+		return true
+	}
+	for _, limit := range s.maxActivePerCategory {
+		if limit > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// canStartNow reports whether a new download can skip the queue. The caller holds queueMu until the
+// download is in the in progress set, so that concurrent downloads can't take the same slot.
+func (s *Service) canStartNow(ctx context.Context, category common.RequestType) bool {
+	if !s.queueEnabled() {
+		return true
+	}
+
+	queued, err := s.redisClient.ZCard(ctx, KeyTorrentQueued).Result()
+	if err != nil || queued > 0 {
+		return false
+	}
+
+	active, err := s.activeDownloads(ctx)
+	if err != nil {
+		log.Printf("failed to count active downloads: %v", err)
+		return false
+	}
+
+	return s.hasFreeSlot(active, category)
+}
+
+// enqueue adds a paused download to the queue and returns its 1-based position
+func (s *Service) enqueue(ctx context.Context, requestID string, record *TorrentRecord) (int64, error) {
+	record.QueuedAt = time.Now().Unix()
+	err := s.redisClient.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), "queued_at", record.QueuedAt).Err()
+	if err != nil {
+		return 0, fmt.Errorf("failed to save queue time: %w", err)
+	}
+
+	err = s.redisClient.ZAdd(ctx, KeyTorrentQueued, redis.Z{Score: queueScore(record.Priority, record.QueuedAt), Member: requestID}).Err()
+	if err != nil {
+		return 0, fmt.Errorf("failed to add requestID to queue: %w", err)
+	}
+
+	log.Printf("Torrent queued (requestID: %s, priority: %s)", requestID, normalizePriority(record.Priority))
+	s.appendHistory(ctx, requestID, "Queued with priority "+normalizePriority(record.Priority).String())
+
+	return s.queuePosition(ctx, requestID), nil
+}
+
+func (s *Service) queuePosition(ctx context.Context, requestID string) int64 {
+	rank, err := s.redisClient.ZRank(ctx, KeyTorrentQueued, requestID).Result()
+	if err != nil {
+		return 0
+	}
+	return rank + 1
+}
+
+// promoteQueued starts queued downloads while there are free slots
+func (s *Service) promoteQueued(ctx context.Context) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	requestIDs, err := s.redisClient.ZRange(ctx, KeyTorrentQueued, 0, -1).Result()
+	if err != nil {
+		log.Printf("failed to get queued downloads: %v", err)
+		return
+	}
+
+	if len(requestIDs) == 0 {
+		return
+	}
+
+	active, err := s.activeDownloads(ctx)
+	if err != nil {
+		log.Printf("failed to count active downloads: %v", err)
+		return
+	}
+
+	records, err := s.getTorrentRecords(ctx, requestIDs)
+	if err != nil {
+		log.Printf("failed to get queued downloads: %v", err)
+		return
+	}
+
+	for _, requestID := range requestIDs {
+		record, ok := records[requestID]
+		if !ok {
+			log.Printf("dropping queued download without record (requestID: %s)", requestID)
+			s.redisClient.ZRem(ctx, KeyTorrentQueued, requestID)
+			continue
+		}
+
+		if !s.hasFreeSlot(active, record.Category) {
+			continue
+		}
+
+		if err := s.startPausedDownload(ctx, requestID, record); err != nil {
+			log.Printf("failed to start queued download (requestID: %s): %v", requestID, err)
+			continue
+		}
+
+		active[record.Category]++
+	}
+}
+
+// startPausedDownload starts a download that was added paused, or a queued direct download, and moves
+// it to the in progress set
+func (s *Service) startPausedDownload(ctx context.Context, requestID string, record *TorrentRecord) error {
+	if record.URL != "" {
+		downloadCtx, cancel := context.WithCancel(context.Background())
+		s.runDirectDownload(downloadCtx, cancel, requestID, record, nil)
+	} else {
+		_, err := s.transmissionClient.StartTorrents(ctx, &transmission.StartTorrentsRequest{
+			TorrentIds: []int64{record.TorrentID},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.redisClient.SAdd(ctx, KeyTorrentInProgress, requestID).Err(); err != nil {
+		return fmt.Errorf("failed to add requestID to in progress set: %w", err)
+	}
+	s.wakeProgressChecker()
+
+	if err := s.redisClient.ZRem(ctx, KeyTorrentQueued, requestID).Err(); err != nil {
+		return fmt.Errorf("failed to remove requestID from queue: %w", err)
+	}
+
+	log.Printf("Paused download started (requestID: %s, torrentID: %d)", requestID, record.TorrentID)
+	s.appendHistory(ctx, requestID, "Download started")
+
+	return s.sendProgressToRedis(ctx, &coordinatorpb.DownloadResponse{
+		RequestId: requestID,
+		Name:      record.Name,
+		Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_IN_PROGRESS,
+		Message:   "▶️ Download started",
+	})
+}
+
+// activeDownloads counts in-progress downloads per category
+func (s *Service) activeDownloads(ctx context.Context) (map[common.RequestType]int, error) {
+	requestIDs, err := s.redisClient.SMembers(ctx, KeyTorrentInProgress).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := s.getTorrentRecords(ctx, requestIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	active := make(map[common.RequestType]int)
+	for _, record := range records {
+		active[record.Category]++
+	}
+
+	return active, nil
+}
+
+func (s *Service) hasFreeSlot(active map[common.RequestType]int, category common.RequestType) bool {
+	if s.maxActiveDownloads > 0 {
+		total := 0
+		for _, count := range active {
+			total += count
+		}
+		if total >= s.maxActiveDownloads {
+			return false
+		}
+	}
+
+	if limit := s.maxActivePerCategory[category]; limit > 0 && active[category] >= limit {
+		return false
+	}
+
+	return true
+}
+
+func (s *Service) SetPriority(ctx context.Context, req *coordinatorpb.SetPriorityRequest) (*coordinatorpb.SetPriorityResponse, error) {
+	priority := normalizePriority(req.Priority)
+	log.Printf("Setting priority (requestID: %s, priority: %s)", req.RequestId, priority)
+
+	record, err := s.getTorrentRecord(ctx, req.RequestId)
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "download not found: %v", err)
+	}
+
+	err = s.redisClient.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, req.RequestId), "priority", int32(priority)).Err()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to save priority to Redis: %v", err)
+	}
+
+	position := int32(0)
+	if s.queuePosition(ctx, req.RequestId) > 0 {
+		err = s.redisClient.ZAddXX(ctx, KeyTorrentQueued, redis.Z{Score: queueScore(priority, record.QueuedAt), Member: req.RequestId}).Err()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to update queue: %v", err)
+		}
+		position = int32(s.queuePosition(ctx, req.RequestId))
+	}
+
+	return &coordinatorpb.SetPriorityResponse{
+		Priority:      priority,
+		QueuePosition: position,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package coordinator
+
+import (
+	"slices"
+	"testing"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+)
+
+// The queue is a sorted set ordered by queueScore, promoteQueued starts its lowest scores first
+func TestQueuePromotionOrder(t *testing.T) {
+	const queuedAt = 1_700_000_000
+
+	type queued struct {
+		requestID string
+		priority  coordinatorpb.DownloadPriority
+		queuedAt  int64
+	}
+	queue := []queued{
+		{"low-old", coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_LOW, queuedAt},
+		{"normal-new", coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_NORMAL, queuedAt + 7200},
+		{"unspecified-mid", coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_UNSPECIFIED, queuedAt + 3600},
+		{"high-newest", coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_HIGH, queuedAt + 86400},
+		{"normal-old", coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_NORMAL, queuedAt + 60},
+	}
+
+	slices.SortStableFunc(queue, func(a, b queued) int {
+		sa, sb := queueScore(a.priority, a.queuedAt), queueScore(b.priority, b.queuedAt)
+		switch {
+		case sa < sb:
+			return -1
+		case sa > sb:
+			return 1
+		}
+		return 0
+	})
+
+	var order []string
+	for _, q := range queue {
+		order = append(order, q.requestID)
+	}
+
+	// High priority goes first however late it was queued, unspecified counts as normal
+	want := []string{"high-newest", "normal-old", "unspecified-mid", "normal-new", "low-old"}
+	if !slices.Equal(order, want) {
+		t.Errorf("promotion order = %v, want %v", order, want)
+	}
+}
+
+// Changing the priority of a queued download keeps its place among downloads of the new priority
+func TestQueueScoreAfterPriorityChange(t *testing.T) {
+	const queuedAt = 1_700_000_000
+
+	raised := queueScore(coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_HIGH, queuedAt+100)
+	olderHigh := queueScore(coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_HIGH, queuedAt)
+	newerHigh := queueScore(coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_HIGH, queuedAt+200)
+	normal := queueScore(coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_NORMAL, queuedAt)
+
+	if !(olderHigh < raised && raised < newerHigh && newerHigh < normal) {
+		t.Errorf("scores = %v < %v < %v < %v should hold", olderHigh, raised, newerHigh, normal)
+	}
+
+	// Scores are float64 in Redis, a second apart must still be told apart
+	if queueScore(coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_LOW, queuedAt) == queueScore(coordinatorpb.DownloadPriority_DOWNLOAD_PRIORITY_LOW, queuedAt+1) {
+		t.Error("downloads queued a second apart got the same score")
+	}
+}
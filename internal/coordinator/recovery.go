@@ -0,0 +1,311 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/proto"
+)
+
+// StartRecoveryService adopts the orphaned torrents found in Transmission on startup, then reconciles
+// the coordinator's records, the bot's downloads and Transmission every CheckInterval: stale records are
+// expired and the bot's downloads that the coordinator no longer tracks get their final update again,
+// or an error if there is none
+func (s *Service) StartRecoveryService(ctx context.Context) {
+	log.Printf("Starting recovery service")
+
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	// Retried until Transmission can be reached
+	adopted := s.adoptOrphanedTorrents(ctx) == nil
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("Recovery service stopped")
+			return
+		case <-ticker.C:
+			if !adopted {
+				adopted = s.adoptOrphanedTorrents(ctx) == nil
+			}
+			s.recoverRecords(ctx)
+		}
+	}
+}
+
+// adoptOrphanedTorrents resumes tracking the torrents added by the coordinator whose record was lost,
+// e.g. after Redis was flushed. Torrents are recognized by their category label and keep their request ID
+// when they carry a request label, so that the bot still gets their updates. Complete torrents are only
+// adopted while the bot waits for them, older ones were already reported, and torrents whose final update
+// was sent are skipped.
+func (s *Service) adoptOrphanedTorrents(ctx context.Context) error {
+	resp, err := s.transmissionClient.ListTorrents(ctx, &transmission.ListTorrentsRequest{})
+	if err != nil {
+		log.Printf("failed to list torrents, orphaned torrents will be adopted later: %v", err)
+		return err
+	}
+
+	tracked := s.trackedTorrents(ctx)
+
+	botRequestIDs, err := s.redisClient.SMembers(ctx, KeyPendingDownloads).Result()
+	if err != nil {
+		log.Printf("failed to get bot downloads: %v", err)
+	}
+	waiting := make(map[string]bool, len(botRequestIDs))
+	for _, requestID := range botRequestIDs {
+		waiting[requestID] = true
+	}
+
+	adopted := 0
+	for _, summary := range resp.Torrents {
+		if _, ok := tracked[summary.TorrentId]; ok {
+			continue
+		}
+
+		category, requestID := s.parseTorrentLabels(summary.Labels)
+		if category == common.RequestType_REQUEST_TYPE_UNSPECIFIED {
+			continue
+		}
+		if summary.Progress >= 100 && !waiting[requestID] {
+			continue
+		}
+
+		if requestID == "" {
+			// Without a request label, a stopped torrent may have failed or been stopped on purpose
+			if summary.Status == transmission.TorrentStatus_STATUS_STOPPED {
+				continue
+			}
+			requestID = uuid.New().String()
+		} else {
+			// A download that was reported as failed or done, or whose record is still there, isn't orphaned
+			exists, err := s.redisClient.Exists(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), fmt.Sprintf(KeyTorrentFinalFormat, requestID)).Result()
+			if err != nil || exists > 0 {
+				continue
+			}
+		}
+
+		log.Printf("Adopting orphaned torrent (torrentID: %d, requestID: %s, category: %s): %s", summary.TorrentId, requestID, category, summary.Name)
+		_, err := s.AdoptTorrent(ctx, &coordinatorpb.AdoptTorrentRequest{
+			RequestId: requestID,
+			TorrentId: summary.TorrentId,
+			Category:  category,
+		})
+		if err != nil {
+			log.Printf("failed to adopt orphaned torrent (torrentID: %d): %v", summary.TorrentId, err)
+			continue
+		}
+
+		s.appendHistory(ctx, requestID, "Recovered on startup, the coordinator had lost its record")
+		adopted++
+	}
+
+	if adopted > 0 {
+		log.Printf("Adopted %d orphaned torrents", adopted)
+	}
+	return nil
+}
+
+// parseTorrentLabels returns the category and request ID the transmission service labeled a torrent with,
+// the unspecified category if it has no known category label
+func (s *Service) parseTorrentLabels(labels []string) (common.RequestType, string) {
+	category := common.RequestType_REQUEST_TYPE_UNSPECIFIED
+	requestID := ""
+	for _, label := range labels {
+		if id, ok := strings.CutPrefix(label, requestLabelPrefix); ok {
+			requestID = id
+			continue
+		}
+
+		value, ok := common.RequestType_value[label]
+		if _, known := s.pbTypeToDownloadPath[common.RequestType(value)]; ok && known {
+			category = common.RequestType(value)
+		}
+	}
+
+	return category, requestID
+}
+
+func (s *Service) recoverRecords(ctx context.Context) {
+	// Nothing is expired while Transmission can't be reached, the records aren't updated then either
+	resp, err := s.transmissionClient.ListTorrents(ctx, &transmission.ListTorrentsRequest{})
+	if err != nil {
+		log.Printf("failed to list torrents, skipping recovery: %v", err)
+		return
+	}
+
+	inClient := make(map[int64]bool, len(resp.Torrents))
+	for _, torrent := range resp.Torrents {
+		inClient[torrent.TorrentId] = true
+	}
+
+	s.expireStaleRecords(ctx, inClient)
+	s.ResumeFinishing(ctx)
+	s.reconcileBotDownloads(ctx)
+}
+
+// expireStaleRecords fails the in progress downloads whose status wasn't read for StaleThreshold and
+// that are gone from Transmission or no longer running, and drops in progress requests without a valid
+// record. Stale downloads that are still there are checked again instead.
+func (s *Service) expireStaleRecords(ctx context.Context, inClient map[int64]bool) {
+	requestIDs, err := s.redisClient.SMembers(ctx, KeyTorrentInProgress).Result()
+	if err != nil {
+		log.Printf("failed to get in progress downloads: %v", err)
+		return
+	}
+
+	records, err := s.getTorrentRecords(ctx, requestIDs)
+	if err != nil {
+		log.Printf("failed to get torrent records: %v", err)
+		return
+	}
+
+	now := time.Now()
+	recheck := false
+	for _, requestID := range requestIDs {
+		record, ok := records[requestID]
+		if !ok {
+			s.expireRecord(ctx, requestID, "", "its record is missing")
+			continue
+		}
+
+		if record.UpdatedAt == 0 {
+			// The record was never checked, e.g. it was just added or started, its clock starts now
+			s.redisClient.HSetNX(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), "updated_at", now.Unix())
+			continue
+		}
+
+		updatedAt := time.Unix(record.UpdatedAt, 0)
+		if now.Sub(updatedAt) < StaleThreshold {
+			continue
+		}
+
+		reason := "no update since " + updatedAt.Format("Mon 02 Jan 15:04")
+		switch {
+		case record.URL == "" && !inClient[record.TorrentID]:
+			reason += ", the torrent is no longer in Transmission"
+		case record.URL != "" && s.directDownloads.get(requestID) == nil:
+			reason += ", the direct download is no longer running"
+		default:
+			log.Printf("Stale download is still running, checking it again (requestID: %s)", requestID)
+			recheck = true
+			continue
+		}
+		s.expireRecord(ctx, requestID, record.Name, reason)
+	}
+
+	if recheck {
+		s.wakeProgressChecker()
+	}
+}
+
+func (s *Service) expireRecord(ctx context.Context, requestID string, name string, reason string) {
+	log.Printf("Expiring stale download (requestID: %s): %s", requestID, reason)
+
+	s.directDownloads.remove(requestID)
+	s.redisClient.SRem(ctx, KeyTorrentInProgress, requestID)
+	s.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentFormat, requestID))
+	s.appendHistory(ctx, requestID, "Expired: "+reason)
+
+	err := s.sendProgressToRedis(ctx, &coordinatorpb.DownloadResponse{
+		RequestId: requestID,
+		Name:      name,
+		Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR,
+		Message:   "❌ Download expired: " + reason,
+	})
+	if err != nil {
+		log.Printf("failed to send progress to Redis: %v", err)
+	}
+}
+
+// reconcileBotDownloads looks for downloads the bot still waits for but the coordinator no longer tracks.
+// Once one stayed so for StaleThreshold, which leaves time for the last update to be delivered, its final
+// update is sent again, or an error if it has none. This is repeated every StaleThreshold until the bot
+// forgets the download.
+func (s *Service) reconcileBotDownloads(ctx context.Context) {
+	botRequestIDs, err := s.redisClient.SMembers(ctx, KeyPendingDownloads).Result()
+	if err != nil {
+		log.Printf("failed to get bot downloads: %v", err)
+		return
+	}
+	if len(botRequestIDs) == 0 {
+		return
+	}
+
+	requestIDs, err := s.trackedRequestIDs(ctx)
+	if err != nil {
+		log.Printf("failed to get tracked requests, skipping bot downloads: %v", err)
+		return
+	}
+
+	tracked := make(map[string]bool, len(requestIDs))
+	for _, requestID := range requestIDs {
+		tracked[requestID] = true
+	}
+
+	now := time.Now()
+	for _, requestID := range botRequestIDs {
+		if tracked[requestID] {
+			continue
+		}
+
+		key := fmt.Sprintf(KeyTorrentOrphanedFormat, requestID)
+		firstSeen, err := s.redisClient.SetNX(ctx, key, now.Unix(), 2*StaleThreshold).Result()
+		if err != nil {
+			log.Printf("failed to mark orphaned download (requestID: %s): %v", requestID, err)
+			continue
+		}
+		if firstSeen {
+			continue
+		}
+
+		seenAt, err := s.redisClient.Get(ctx, key).Int64()
+		if err != nil || now.Sub(time.Unix(seenAt, 0)) < StaleThreshold {
+			continue
+		}
+
+		if err := s.resendFinalUpdate(ctx, requestID); err != nil {
+			log.Printf("failed to resend final update (requestID: %s): %v", requestID, err)
+			continue
+		}
+
+		s.redisClient.Set(ctx, key, now.Unix(), 2*StaleThreshold)
+	}
+}
+
+// resendFinalUpdate sends the saved final update of a download again, or an error if there is none
+func (s *Service) resendFinalUpdate(ctx context.Context, requestID string) error {
+	data, err := s.redisClient.Get(ctx, fmt.Sprintf(KeyTorrentFinalFormat, requestID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		log.Printf("Bot download is unknown to the coordinator, failing it (requestID: %s)", requestID)
+		s.appendHistory(ctx, requestID, "Lost: no final update was recorded")
+
+		return s.sendProgressToRedis(ctx, &coordinatorpb.DownloadResponse{
+			RequestId: requestID,
+			Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_ERROR,
+			Message:   "❌ Download lost",
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	progress := &coordinatorpb.DownloadResponse{}
+	if err := proto.Unmarshal(data, progress); err != nil {
+		return fmt.Errorf("failed to unmarshal final update: %w", err)
+	}
+
+	log.Printf("Resending final update (requestID: %s, status: %s)", requestID, progress.Status)
+	s.appendHistory(ctx, requestID, "Final update sent again")
+
+	return s.sendProgressToRedis(ctx, progress)
+}
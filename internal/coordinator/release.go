@@ -0,0 +1,79 @@
+package coordinator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Release tags that end the title part of a name
+	qualityPattern = regexp.MustCompile(`(?i)\b(2160p|1080p|1080i|720p|576p|480p|4k|uhd|hdr|bluray|blu-ray|bdrip|brrip|web-?dl|webrip|web|hdtv|hdrip|dvdrip|dvd|x264|x265|h\.?264|h\.?265|hevc|xvid|remux|proper|repack)\b`)
+	// Bracketed groups, e.g. [rarbg] or {tags}
+	bracketPattern = regexp.MustCompile(`\[[^\]]*\]|\{[^}]*\}`)
+	// Separators used instead of spaces in release names
+	separatorPattern = regexp.MustCompile(`[._]+|\s+`)
+	// Characters not allowed in file names
+	unsafePathPattern = regexp.MustCompile(`[/\\:*?"<>|]+`)
+)
+
+// MovieTitle returns the Plex folder name of a movie release, e.g. "Movie Title (2019)"
+func MovieTitle(name string) string {
+	name = bracketPattern.ReplaceAllString(name, " ")
+
+	year := ""
+	if loc := findYear(name); loc != nil {
+		year = strings.Trim(name[loc[0]:loc[1]], "()[]")
+		name = name[:loc[0]]
+	}
+
+	return withYear(cleanTitle(name), year)
+}
+
+// ShowTitle returns the Plex folder name of a show from the raw title of a release, keeping its year if present
+func ShowTitle(rawTitle string) string {
+	rawTitle = bracketPattern.ReplaceAllString(rawTitle, " ")
+
+	year := ""
+	if loc := findYear(rawTitle); loc != nil {
+		year = strings.Trim(rawTitle[loc[0]:loc[1]], "()[]")
+		rawTitle = rawTitle[:loc[0]] + " " + rawTitle[loc[1]:]
+	}
+
+	return withYear(cleanTitle(rawTitle), year)
+}
+
+// EpisodeFileName returns the Plex file name of an episode without extension, e.g. "Show - S01E02" or "Show - S01E02-E03"
+func EpisodeFileName(show string, episodes []Episode) string {
+	name := fmt.Sprintf("%s - %s", show, episodes[0])
+	if len(episodes) > 1 {
+		name += fmt.Sprintf("-E%02d", episodes[len(episodes)-1].Episode)
+	}
+	return name
+}
+
+// findYear returns the location of the first year that is not at the start of the name, so "1917.2019" keeps 1917 as title
+func findYear(name string) []int {
+	for _, loc := range yearPattern.FindAllStringIndex(name, -1) {
+		if loc[0] > 0 {
+			return loc
+		}
+	}
+	return nil
+}
+
+func cleanTitle(title string) string {
+	if loc := qualityPattern.FindStringIndex(title); loc != nil && loc[0] > 0 {
+		title = title[:loc[0]]
+	}
+	title = unsafePathPattern.ReplaceAllString(title, " ")
+	title = separatorPattern.ReplaceAllString(title, " ")
+	return strings.Trim(title, " -()")
+}
+
+func withYear(title string, year string) string {
+	if year == "" {
+		return title
+	}
+	return fmt.Sprintf("%s (%s)", title, year)
+}
@@ -0,0 +1,100 @@
+package coordinator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeWindow is a daily time range in local time, it may span midnight (e.g. 23:00-07:00)
+type TimeWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseTimeWindows parses a comma-separated list of HH:MM-HH:MM ranges
+func ParseTimeWindows(value string) ([]TimeWindow, error) {
+	var windows []TimeWindow
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		startStr, endStr, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid time window %q: expected HH:MM-HH:MM", part)
+		}
+
+		start, err := parseClock(startStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time window %q: %w", part, err)
+		}
+		end, err := parseClock(endStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time window %q: %w", part, err)
+		}
+
+		windows = append(windows, TimeWindow{Start: start, End: end})
+	}
+
+	return windows, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// InWindows reports whether t falls inside any of the windows
+func InWindows(windows []TimeWindow, t time.Time) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextWindowStart returns t if it is inside a window, otherwise the closest window start after t.
+// It returns the zero time if there are no windows.
+func NextWindowStart(windows []TimeWindow, t time.Time) time.Time {
+	if InWindows(windows, t) {
+		return t
+	}
+
+	var next time.Time
+	for _, w := range windows {
+		candidate := atClock(t, 0, w.Start)
+		if !candidate.After(t) {
+			candidate = atClock(t, 1, w.Start)
+		}
+		if next.IsZero() || candidate.Before(next) {
+			next = candidate
+		}
+	}
+
+	return next
+}
+
+// atClock returns the wall clock time of day, days after the day of t. Adding the offset to midnight would be
+// an hour off on days when the clocks change.
+func atClock(t time.Time, days int, clock time.Duration) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+days, int(clock/time.Hour), int(clock%time.Hour/time.Minute), 0, 0, t.Location())
+}
+
+func parseClock(value string) (time.Duration, error) {
+	clock, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", value)
+	}
+	return time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute, nil
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
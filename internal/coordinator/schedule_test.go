@@ -0,0 +1,86 @@
+package coordinator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindows(t *testing.T) {
+	windows, err := ParseTimeWindows(" 23:30-07:00, ,12:00-13:15")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TimeWindow{
+		{Start: 23*time.Hour + 30*time.Minute, End: 7 * time.Hour},
+		{Start: 12 * time.Hour, End: 13*time.Hour + 15*time.Minute},
+	}
+	if len(windows) != len(want) || windows[0] != want[0] || windows[1] != want[1] {
+		t.Errorf("windows = %v, want %v", windows, want)
+	}
+
+	for _, value := range []string{"01:00", "01:00-25:00", "1am-7am", "01:00-07:00,bad"} {
+		if _, err := ParseTimeWindows(value); err == nil {
+			t.Errorf("ParseTimeWindows(%q) should fail", value)
+		}
+	}
+}
+
+func TestWindowSpanningMidnight(t *testing.T) {
+	night := TimeWindow{Start: 23 * time.Hour, End: 7 * time.Hour}
+	day := func(hour, minute int) time.Time { return time.Date(2024, 6, 1, hour, minute, 0, 0, time.UTC) }
+
+	for clock, want := range map[time.Time]bool{
+		day(22, 59): false,
+		day(23, 0):  true,
+		day(2, 0):   true,
+		day(6, 59):  true,
+		day(7, 0):   false,
+		day(12, 0):  false,
+	} {
+		if got := night.Contains(clock); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", clock.Format("15:04"), got, want)
+		}
+	}
+}
+
+func TestNextWindowStart(t *testing.T) {
+	windows := []TimeWindow{{Start: 1 * time.Hour, End: 7 * time.Hour}, {Start: 13 * time.Hour, End: 14 * time.Hour}}
+
+	inWindow := time.Date(2024, 6, 1, 2, 0, 0, 0, time.UTC)
+	if got := NextWindowStart(windows, inWindow); !got.Equal(inWindow) {
+		t.Errorf("inside a window: got %s, want now", got)
+	}
+
+	morning := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	if got, want := NextWindowStart(windows, morning), time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("before the afternoon window: got %s, want %s", got, want)
+	}
+
+	evening := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	if got, want := NextWindowStart(windows, evening), time.Date(2024, 6, 2, 1, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("after the last window: got %s, want %s", got, want)
+	}
+
+	if got := NextWindowStart(nil, evening); !got.IsZero() {
+		t.Errorf("without windows: got %s, want the zero time", got)
+	}
+}
+
+func TestNextWindowStartOnClockChange(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("time zone database unavailable: %v", err)
+	}
+	windows := []TimeWindow{{Start: 5 * time.Hour, End: 7 * time.Hour}}
+
+	// Clocks go forward from 02:00 to 03:00 on 31 March 2024 and back from 03:00 to 02:00 on 27 October 2024
+	for _, day := range []time.Time{
+		time.Date(2024, time.March, 31, 0, 30, 0, 0, berlin),
+		time.Date(2024, time.October, 27, 0, 30, 0, 0, berlin),
+	} {
+		got := NextWindowStart(windows, day)
+		if want := time.Date(day.Year(), day.Month(), day.Day(), 5, 0, 0, 0, berlin); !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", day.Month(), got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	schedulerInterval = 1 * time.Minute
+)
+
+// StartSchedulerService starts scheduled downloads when they are due and
+// switches Transmission alt-speed mode according to the configured windows
+func (s *Service) StartSchedulerService(ctx context.Context) {
+	log.Printf("Starting scheduler service")
+
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		s.startScheduledDownloads(ctx)
+		s.applyAltSpeedWindows(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Scheduler service stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolveStartAt returns when a new download should start, the zero time means immediately.
+// Starting in the download window fails if no window is configured.
+func (s *Service) resolveStartAt(startAt int64, startInWindow bool) (time.Time, error) {
+	now := time.Now()
+
+	if startInWindow {
+		if len(s.downloadWindows) == 0 {
+			return time.Time{}, status.Error(codes.FailedPrecondition, "no download window is configured, start the download now or at a specific time")
+		}
+
+		next := NextWindowStart(s.downloadWindows, now)
+		if next.After(now) {
+			return next, nil
+		}
+		return time.Time{}, nil
+	}
+
+	if startAt > now.Unix() {
+		return time.Unix(startAt, 0), nil
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *Service) startScheduledDownloads(ctx context.Context) {
+	requestIDs, err := s.redisClient.ZRangeByScore(ctx, KeyTorrentScheduled, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().Unix(), 10),
+	}).Result()
+	if err != nil {
+		log.Printf("failed to get scheduled downloads: %v", err)
+		return
+	}
+
+	for _, requestID := range requestIDs {
+		if err := s.startScheduledDownload(ctx, requestID); err != nil {
+			log.Printf("failed to start scheduled download (requestID: %s): %v", requestID, err)
+		}
+	}
+
+	if len(requestIDs) > 0 {
+		s.promoteQueued(ctx)
+	}
+}
+
+func (s *Service) startScheduledDownload(ctx context.Context, requestID string) error {
+	record, err := s.getTorrentRecord(ctx, requestID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.redisClient.ZRem(ctx, KeyTorrentScheduled, requestID).Err(); err != nil {
+		return fmt.Errorf("failed to remove requestID from scheduled set: %w", err)
+	}
+
+	log.Printf("Scheduled download is due (requestID: %s, torrentID: %d)", requestID, record.TorrentID)
+
+	if !s.queueEnabled() {
+		return s.startPausedDownload(ctx, requestID, record)
+	}
+
+	position, err := s.enqueue(ctx, requestID, record)
+	if err != nil {
+		return err
+	}
+
+	return s.sendProgressToRedis(ctx, &coordinatorpb.DownloadResponse{
+		RequestId: requestID,
+		Name:      record.Name,
+		Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_QUEUED,
+		Message:   fmt.Sprintf("📋 Download queued (position %d)", position),
+	})
+}
+
+// applyAltSpeedWindows switches alt-speed mode when a window starts or ends, so that a manual
+// switch with SetSpeed lasts until the next window boundary
+func (s *Service) applyAltSpeedWindows(ctx context.Context) {
+	if len(s.altSpeedWindows) == 0 {
+		return
+	}
+
+	inWindow := InWindows(s.altSpeedWindows, time.Now())
+	if s.altSpeedInWindow != nil && *s.altSpeedInWindow == inWindow {
+		return
+	}
+
+	// The mode may have been switched by hand since the last boundary
+	session, err := s.transmissionClient.GetSession(ctx, &transmission.GetSessionRequest{})
+	if err != nil {
+		log.Printf("failed to get transmission session, alt-speed mode is switched later: %v", err)
+		return
+	}
+
+	if session.AltSpeedEnabled != inWindow {
+		_, err := s.transmissionClient.SetSession(ctx, &transmission.SetSessionRequest{
+			AltSpeedEnabled: &inWindow,
+		})
+		if err != nil {
+			log.Printf("failed to switch alt-speed mode: %v", err)
+			return
+		}
+
+		log.Printf("Alt-speed mode switched (enabled: %t)", inWindow)
+	}
+
+	s.altSpeedInWindow = &inWindow
+}
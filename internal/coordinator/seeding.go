@@ -0,0 +1,218 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+// SeedingRule defines when a completed torrent has seeded enough
+type SeedingRule struct {
+	// Ratio is the target upload ratio, 0 means no ratio target
+	Ratio float64
+	// MaxSeedingTime is the maximum time to seed, 0 means no time limit
+	MaxSeedingTime time.Duration
+}
+
+// IsSet reports whether the rule has any target
+func (r SeedingRule) IsSet() bool {
+	return r.Ratio > 0 || r.MaxSeedingTime > 0
+}
+
+// String returns a human readable description of the rule
+func (r SeedingRule) String() string {
+	var parts []string
+	if r.Ratio > 0 {
+		parts = append(parts, fmt.Sprintf("ratio %.2f", r.Ratio))
+	}
+	if r.MaxSeedingTime > 0 {
+		parts = append(parts, fmt.Sprintf("%s of seeding", r.MaxSeedingTime))
+	}
+	return strings.Join(parts, " or ")
+}
+
+// ParseSeedingRules parses comma-separated CATEGORY=ratio/time rules, e.g. "FILMS=2/72h,SERIES=1.5/,*=/24h".
+// The * category is the default for categories without a rule.
+func ParseSeedingRules(value string) (map[common.RequestType]SeedingRule, error) {
+	rules := make(map[common.RequestType]SeedingRule)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, spec, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid seeding rule %q: expected CATEGORY=ratio/time", part)
+		}
+
+		category := common.RequestType_REQUEST_TYPE_UNSPECIFIED
+		if name != "*" {
+			value, ok := common.RequestType_value[strings.ToUpper(strings.TrimSpace(name))]
+			if !ok {
+				return nil, fmt.Errorf("invalid seeding rule %q: unknown category %q", part, name)
+			}
+			category = common.RequestType(value)
+		}
+
+		ratioStr, timeStr, _ := strings.Cut(spec, "/")
+		var rule SeedingRule
+		if ratioStr = strings.TrimSpace(ratioStr); ratioStr != "" {
+			ratio, err := strconv.ParseFloat(ratioStr, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid seeding rule %q: bad ratio: %w", part, err)
+			}
+			rule.Ratio = ratio
+		}
+		if timeStr = strings.TrimSpace(timeStr); timeStr != "" {
+			duration, err := time.ParseDuration(timeStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid seeding rule %q: bad time: %w", part, err)
+			}
+			rule.MaxSeedingTime = duration
+		}
+
+		rules[category] = rule
+	}
+
+	return rules, nil
+}
+
+func (s *Service) seedingRule(category common.RequestType) SeedingRule {
+	if rule, ok := s.seedingRules[category]; ok {
+		return rule
+	}
+	return s.seedingRules[common.RequestType_REQUEST_TYPE_UNSPECIFIED]
+}
+
+// startSeeding applies the seeding rule of a completed download and keeps tracking it.
+// It returns false if the category has no seeding rule.
+func (s *Service) startSeeding(ctx context.Context, requestID string) bool {
+	record, err := s.getTorrentRecord(ctx, requestID)
+	if err != nil {
+		log.Printf("failed to get torrent record for seeding (requestID: %s): %v", requestID, err)
+		return false
+	}
+
+	rule := s.seedingRule(record.Category)
+	if !rule.IsSet() {
+		return false
+	}
+
+	_, err = s.transmissionClient.SetSeedLimits(ctx, &transmission.SetSeedLimitsRequest{
+		TorrentId:  record.TorrentID,
+		RatioLimit: rule.Ratio,
+	})
+	if err != nil {
+		log.Printf("failed to set seed limits (requestID: %s): %v", requestID, err)
+	}
+
+	if err := s.redisClient.SAdd(ctx, KeyTorrentSeeding, requestID).Err(); err != nil {
+		log.Printf("failed to add requestID to seeding set: %v", err)
+		return false
+	}
+
+	log.Printf("Torrent seeding (requestID: %s, rule: %s)", requestID, rule)
+	s.appendHistory(ctx, requestID, "Seeding until "+rule.String())
+
+	return true
+}
+
+// checkSeeding stops or removes completed torrents that met their seeding rule
+func (s *Service) checkSeeding(ctx context.Context) {
+	requestIDs, err := s.redisClient.SMembers(ctx, KeyTorrentSeeding).Result()
+	if err != nil {
+		log.Printf("failed to get seeding torrents: %v", err)
+		return
+	}
+
+	records, statuses, err := s.getTorrentsStatus(ctx, requestIDs)
+	if err != nil {
+		log.Printf("failed to get seeding torrents status: %v", err)
+		return
+	}
+
+	for _, requestID := range requestIDs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		record, ok := records[requestID]
+		if !ok {
+			continue
+		}
+
+		statusResp, ok := statuses[requestID]
+		if !ok {
+			s.appendHistory(ctx, requestID, "Torrent is no longer in Transmission")
+			s.finishSeeding(ctx, requestID)
+			continue
+		}
+
+		done, summary := seedingDone(s.seedingRule(record.Category), statusResp)
+		if !done {
+			continue
+		}
+		stopped := statusResp.Status == transmission.TorrentStatus_STATUS_STOPPED
+		log.Printf("Seeding finished (requestID: %s): %s", requestID, summary)
+
+		if s.removeAfterSeeding {
+			_, err := s.transmissionClient.RemoveTorrent(ctx, &transmission.RemoveTorrentRequest{
+				TorrentId:       record.TorrentID,
+				DeleteLocalData: false,
+			})
+			if err != nil {
+				log.Printf("failed to remove torrent (requestID: %s): %v", requestID, err)
+				continue
+			}
+			s.appendHistory(ctx, requestID, "Removed from Transmission, files kept: "+summary)
+		} else {
+			if !stopped {
+				_, err := s.transmissionClient.StopTorrents(ctx, &transmission.StopTorrentsRequest{TorrentIds: []int64{record.TorrentID}})
+				if err != nil {
+					log.Printf("failed to stop torrent (requestID: %s): %v", requestID, err)
+					continue
+				}
+			}
+			s.appendHistory(ctx, requestID, "Seeding stopped: "+summary)
+		}
+
+		s.finishSeeding(ctx, requestID)
+	}
+}
+
+// seedingDone reports whether a torrent is done seeding: its rule is met, or it was stopped in the
+// client (by hand or by a global limit) and won't upload any more. Torrents stopped by an error keep seeding
+// so that they finish once the error is resolved.
+func seedingDone(rule SeedingRule, statusResp *transmission.GetTorrentStatusResponse) (bool, string) {
+	seedingTime := time.Duration(statusResp.SecondsSeeding) * time.Second
+	summary := fmt.Sprintf("ratio %.2f after %s of seeding", statusResp.UploadRatio, seedingTime.Round(time.Minute))
+
+	ratioMet := rule.Ratio > 0 && statusResp.UploadRatio >= rule.Ratio
+	timeMet := rule.MaxSeedingTime > 0 && seedingTime >= rule.MaxSeedingTime
+	if ratioMet || timeMet {
+		return true, summary
+	}
+
+	if statusResp.Status == transmission.TorrentStatus_STATUS_STOPPED {
+		return true, "stopped in the torrent client, " + summary
+	}
+
+	return false, summary
+}
+
+func (s *Service) finishSeeding(ctx context.Context, requestID string) {
+	if err := s.redisClient.SRem(ctx, KeyTorrentSeeding, requestID).Err(); err != nil {
+		log.Printf("failed to remove requestID from seeding set: %v", err)
+	}
+
+	if err := s.redisClient.Del(ctx, fmt.Sprintf(KeyTorrentFormat, requestID)).Err(); err != nil {
+		log.Printf("failed to delete torrent from Redis: %v", err)
+	}
+}
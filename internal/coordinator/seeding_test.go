@@ -0,0 +1,79 @@
+package coordinator
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+func TestSeedingRulesFallBackToDefault(t *testing.T) {
+	rules, err := ParseSeedingRules("FILMS=2/72h, series=1.5/, *=/24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{seedingRules: rules}
+
+	if rule := s.seedingRule(common.RequestType_FILMS); rule != (SeedingRule{Ratio: 2, MaxSeedingTime: 72 * time.Hour}) {
+		t.Errorf("FILMS rule = %+v", rule)
+	}
+	if rule := s.seedingRule(common.RequestType_SERIES); rule != (SeedingRule{Ratio: 1.5}) {
+		t.Errorf("SERIES rule = %+v", rule)
+	}
+	if rule := s.seedingRule(common.RequestType_CARTOONS); rule != (SeedingRule{MaxSeedingTime: 24 * time.Hour}) {
+		t.Errorf("CARTOONS should use the * rule, got %+v", rule)
+	}
+
+	if rule := (&Service{}).seedingRule(common.RequestType_FILMS); rule.IsSet() {
+		t.Errorf("no rules should seed indefinitely, got %+v", rule)
+	}
+}
+
+func TestParseSeedingRulesRejectsInvalidRules(t *testing.T) {
+	for _, value := range []string{"FILMS", "MUSIC=1/", "FILMS=high/", "FILMS=/3 days"} {
+		if _, err := ParseSeedingRules(value); err == nil {
+			t.Errorf("ParseSeedingRules(%q) should fail", value)
+		}
+	}
+}
+
+func TestSeedingDone(t *testing.T) {
+	rule := SeedingRule{Ratio: 2, MaxSeedingTime: 72 * time.Hour}
+	seeding := func(torrentStatus transmission.TorrentStatus, ratio float64, seeded time.Duration) *transmission.GetTorrentStatusResponse {
+		return &transmission.GetTorrentStatusResponse{
+			Status:         torrentStatus,
+			UploadRatio:    ratio,
+			SecondsSeeding: int64(seeded / time.Second),
+		}
+	}
+
+	if done, _ := seedingDone(rule, seeding(transmission.TorrentStatus_STATUS_DONE, 0.5, time.Hour)); done {
+		t.Error("a seeding torrent below its targets should keep seeding")
+	}
+	if done, _ := seedingDone(rule, seeding(transmission.TorrentStatus_STATUS_DONE, 2, time.Hour)); !done {
+		t.Error("the ratio target should finish seeding")
+	}
+	if done, _ := seedingDone(rule, seeding(transmission.TorrentStatus_STATUS_DONE, 0.5, 72*time.Hour)); !done {
+		t.Error("the time target should finish seeding")
+	}
+	if done, _ := seedingDone(rule, seeding(transmission.TorrentStatus_STATUS_ERROR, 0.5, time.Hour)); done {
+		t.Error("a torrent stopped by an error should keep its rule")
+	}
+
+	// Paused by hand, the torrent won't upload any more so it would never meet its rule
+	done, summary := seedingDone(rule, seeding(transmission.TorrentStatus_STATUS_STOPPED, 0.5, time.Hour))
+	if !done {
+		t.Fatal("a torrent paused by hand should finish seeding")
+	}
+	if !strings.Contains(summary, "stopped in the torrent client") {
+		t.Errorf("summary = %q, should say the torrent was stopped", summary)
+	}
+
+	// A time only rule whose torrent was stopped by the global ratio limit of the client
+	timeOnly := SeedingRule{MaxSeedingTime: 24 * time.Hour}
+	if done, _ := seedingDone(timeOnly, seeding(transmission.TorrentStatus_STATUS_STOPPED, 2, time.Hour)); !done {
+		t.Error("a torrent stopped by the client's ratio limit should finish seeding")
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
 	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
 	"github.com/aquare11e/media-downloader-bot/common/protogen/plex"
 	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
 	"github.com/redis/go-redis/v9"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -18,29 +21,79 @@ import (
 type Service struct {
 	coordinatorpb.UnimplementedCoordinatorServiceServer
 	transmissionClient   transmission.TransmissionServiceClient
-	plexClient           plex.PlexServiceClient
+	mediaServers         []mediaServer
 	redisClient          *redis.Client
 	pbTypeToDownloadPath map[common.RequestType]string
+	downloadWindows      []TimeWindow
+	altSpeedWindows      []TimeWindow
+	altSpeedInWindow     *bool
+	maxActiveDownloads   int
+	maxActivePerCategory map[common.RequestType]int
+	queueMu              sync.Mutex
+	minFreeSpaceBytes    int64
+	diskSpacePolicy      DiskSpacePolicy
+	seedingRules         map[common.RequestType]SeedingRule
+	removeAfterSeeding   bool
+	importMode           ImportMode
+	pathMapping          paths.Mapping
+	extractArchives      bool
+	plexConfirmTimeout   time.Duration
+	directDownloads      directDownloads
+	finishing            finishingDownloads
+	progressWake         chan struct{}
 }
 
-func NewService(transmissionConn, plexConn *grpc.ClientConn, redisClient *redis.Client, pbTypeToDownloadPath map[common.RequestType]string) *Service {
+func NewService(transmissionConn *grpc.ClientConn, mediaServerConns []*grpc.ClientConn, redisClient *redis.Client, pbTypeToDownloadPath map[common.RequestType]string, opts Options) *Service {
+	mediaServers := make([]mediaServer, 0, len(mediaServerConns))
+	for _, conn := range mediaServerConns {
+		mediaServers = append(mediaServers, mediaServer{name: conn.Target(), client: plex.NewPlexServiceClient(conn)})
+	}
+
 	return &Service{
 		transmissionClient:   transmission.NewTransmissionServiceClient(transmissionConn),
-		plexClient:           plex.NewPlexServiceClient(plexConn),
+		mediaServers:         mediaServers,
 		redisClient:          redisClient,
 		pbTypeToDownloadPath: pbTypeToDownloadPath,
+		downloadWindows:      opts.DownloadWindows,
+		altSpeedWindows:      opts.AltSpeedWindows,
+		maxActiveDownloads:   opts.MaxActiveDownloads,
+		maxActivePerCategory: opts.MaxActiveDownloadsPerCategory,
+		minFreeSpaceBytes:    opts.MinFreeSpaceBytes,
+		diskSpacePolicy:      opts.DiskSpacePolicy,
+		seedingRules:         opts.SeedingRules,
+		removeAfterSeeding:   opts.RemoveAfterSeeding,
+		importMode:           opts.ImportMode,
+		pathMapping:          opts.PathMapping,
+		extractArchives:      opts.ExtractArchives,
+		plexConfirmTimeout:   opts.PlexConfirmTimeout,
+		progressWake:         make(chan struct{}, 1),
 	}
 }
 
 func (s *Service) AddTorrentByMagnet(ctx context.Context, req *coordinatorpb.AddTorrentByMagnetRequest) (*coordinatorpb.DownloadResponse, error) {
 	log.Printf("Adding torrent by magnet (requestID: %s, category: %s)", req.RequestId, req.Category)
 
-	return s.executeWithLogging(ctx, req.RequestId, req.Category, func() (*transmission.AddTorrentResponse, error) {
-		return s.transmissionClient.AddTorrentByMagnet(ctx, &transmission.AddTorrentByMagnetRequest{
-			MagnetLink: req.MagnetLink,
-			Filedir:    s.pbTypeToDownloadPath[req.Category],
-			RequestId:  req.RequestId,
-			Category:   req.Category.String(),
+	return s.addOnce(ctx, req.RequestId, func() (*coordinatorpb.DownloadResponse, error) {
+		// Torrent file links are only fetched for series, to read the name of the torrent
+		if isSeriesCategory(req.Category) {
+			if err := s.checkDuplicateEpisodes(ctx, req.Category, torrentLinkName(ctx, req.MagnetLink)); err != nil {
+				return nil, err
+			}
+		}
+
+		startAt, err := s.resolveStartAt(req.StartAt, req.StartInWindow)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.executeWithLogging(ctx, req.RequestId, req.Requester, req.Category, startAt, req.Priority, func(paused bool) (*transmission.AddTorrentResponse, error) {
+			return s.transmissionClient.AddTorrentByMagnet(ctx, &transmission.AddTorrentByMagnetRequest{
+				MagnetLink: req.MagnetLink,
+				Filedir:    s.downloadDir(req.Category),
+				RequestId:  req.RequestId,
+				Category:   req.Category.String(),
+				Paused:     paused,
+			})
 		})
 	})
 }
@@ -48,12 +101,24 @@ func (s *Service) AddTorrentByMagnet(ctx context.Context, req *coordinatorpb.Add
 func (s *Service) AddTorrentByFile(ctx context.Context, req *coordinatorpb.AddTorrentByFileRequest) (*coordinatorpb.DownloadResponse, error) {
 	log.Printf("Adding torrent by file (requestID: %s, category: %s)", req.RequestId, req.Category)
 
-	return s.executeWithLogging(ctx, req.RequestId, req.Category, func() (*transmission.AddTorrentResponse, error) {
-		return s.transmissionClient.AddTorrentByFile(ctx, &transmission.AddTorrentByFileRequest{
-			Base64File: req.Base64File,
-			Filedir:    s.pbTypeToDownloadPath[req.Category],
-			RequestId:  req.RequestId,
-			Category:   req.Category.String(),
+	return s.addOnce(ctx, req.RequestId, func() (*coordinatorpb.DownloadResponse, error) {
+		if err := s.checkDuplicateEpisodes(ctx, req.Category, base64TorrentName(req.Base64File)); err != nil {
+			return nil, err
+		}
+
+		startAt, err := s.resolveStartAt(req.StartAt, req.StartInWindow)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.executeWithLogging(ctx, req.RequestId, req.Requester, req.Category, startAt, req.Priority, func(paused bool) (*transmission.AddTorrentResponse, error) {
+			return s.transmissionClient.AddTorrentByFile(ctx, &transmission.AddTorrentByFileRequest{
+				Base64File: req.Base64File,
+				Filedir:    s.downloadDir(req.Category),
+				RequestId:  req.RequestId,
+				Category:   req.Category.String(),
+				Paused:     paused,
+			})
 		})
 	})
 }
@@ -61,31 +126,81 @@ func (s *Service) AddTorrentByFile(ctx context.Context, req *coordinatorpb.AddTo
 func (s *Service) executeWithLogging(
 	ctx context.Context,
 	requestID string,
+	requester string,
 	category common.RequestType,
-	fn func() (*transmission.AddTorrentResponse, error),
+	startAt time.Time,
+	priority coordinatorpb.DownloadPriority,
+	fn func(paused bool) (*transmission.AddTorrentResponse, error),
 ) (*coordinatorpb.DownloadResponse, error) {
-	response, err := fn()
+	if err := s.checkFreeSpaceBeforeAdd(ctx, category); err != nil {
+		return nil, err
+	}
+
+	scheduled := !startAt.IsZero()
+	if !scheduled && s.queueEnabled() {
+		// Check for a free slot and take it by adding the download at once
+		s.queueMu.Lock()
+		defer s.queueMu.Unlock()
+	}
+	queued := !scheduled && !s.canStartNow(ctx, category)
+
+	response, err := s.addTorrentOnce(ctx, requestID, scheduled || queued, fn)
 	if err != nil {
-		log.Printf("Error occurred (requestID: %s): %v", requestID, err)
-		return nil, status.Errorf(codes.Internal, "failed to execute function: %v", err)
+		return nil, err
 	}
 
-	log.Printf("Torrent added (requestID: %s, torrentID: %d)", requestID, response.TorrentId)
+	s.saveRequester(ctx, requestID, requester)
 
 	// Save to Redis
 	torrentRecord := &TorrentRecord{
 		TorrentID: response.TorrentId,
 		Category:  category,
+		Name:      response.Name,
+		Priority:  priority,
 	}
 	err = s.redisClient.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, requestID), torrentRecord.ToRedisMap()).Err()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to save to Redis torrent record: %v", err)
 	}
 
+	if scheduled {
+		err = s.redisClient.ZAdd(ctx, KeyTorrentScheduled, redis.Z{Score: float64(startAt.Unix()), Member: requestID}).Err()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to add to Redis requestID to scheduled set: %v", err)
+		}
+
+		log.Printf("Torrent scheduled (requestID: %s, startAt: %s)", requestID, startAt)
+		s.appendHistory(ctx, requestID, "Scheduled for "+startAt.Format(time.RFC3339))
+
+		return &coordinatorpb.DownloadResponse{
+			Name:      response.Name,
+			RequestId: requestID,
+			Progress:  0,
+			Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_SCHEDULED,
+			Message:   "🕒 Download scheduled for " + startAt.Format("Mon 02 Jan 15:04"),
+		}, nil
+	}
+
+	if queued {
+		position, err := s.enqueue(ctx, requestID, torrentRecord)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to queue download: %v", err)
+		}
+
+		return &coordinatorpb.DownloadResponse{
+			Name:      response.Name,
+			RequestId: requestID,
+			Progress:  0,
+			Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_QUEUED,
+			Message:   fmt.Sprintf("📋 Download queued (position %d)", position),
+		}, nil
+	}
+
 	err = s.redisClient.SAdd(ctx, KeyTorrentInProgress, requestID).Err()
 	if err != nil {
 		return nil, status.Errorf(codes.Internal, "failed to add to Redis requestID to in progress set: %v", err)
 	}
+	s.wakeProgressChecker()
 
 	return &coordinatorpb.DownloadResponse{
 		Name:      response.Name,
@@ -95,3 +210,56 @@ func (s *Service) executeWithLogging(
 		Message:   "Download started",
 	}, nil
 }
+
+func (s *Service) getTorrentRecord(ctx context.Context, requestID string) (*TorrentRecord, error) {
+	res, err := s.redisClient.HGetAll(ctx, fmt.Sprintf(KeyTorrentFormat, requestID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get torrent record: %w", err)
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("torrent record not found (requestID: %s)", requestID)
+	}
+
+	record := &TorrentRecord{}
+	if err := record.FromRedisMap(res); err != nil {
+		return nil, fmt.Errorf("failed to parse torrent record: %w", err)
+	}
+
+	return record, nil
+}
+
+// getTorrentRecords reads many torrent records in a single round trip, missing or invalid records are left out
+func (s *Service) getTorrentRecords(ctx context.Context, requestIDs []string) (map[string]*TorrentRecord, error) {
+	records := make(map[string]*TorrentRecord, len(requestIDs))
+	if len(requestIDs) == 0 {
+		return records, nil
+	}
+
+	pipe := s.redisClient.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(requestIDs))
+	for i, requestID := range requestIDs {
+		cmds[i] = pipe.HGetAll(ctx, fmt.Sprintf(KeyTorrentFormat, requestID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get torrent records: %w", err)
+	}
+
+	for i, cmd := range cmds {
+		res := cmd.Val()
+		if len(res) == 0 {
+			log.Printf("torrent record not found (requestID: %s)", requestIDs[i])
+			continue
+		}
+
+		record := &TorrentRecord{}
+		if err := record.FromRedisMap(res); err != nil {
+			log.Printf("failed to parse torrent record (requestID: %s): %v", requestIDs[i], err)
+			continue
+		}
+		records[requestIDs[i]] = record
+	}
+
+	return records, nil
+}
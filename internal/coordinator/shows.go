@@ -0,0 +1,193 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Service) AddShow(ctx context.Context, req *coordinatorpb.AddShowRequest) (*coordinatorpb.Show, error) {
+	title := strings.TrimSpace(req.Title)
+	key := NormalizeTitle(title)
+	if key == "" {
+		return nil, status.Error(codes.InvalidArgument, "show title is empty")
+	}
+
+	log.Printf("Adding show to watchlist (title: %s, key: %s)", title, key)
+
+	if err := s.redisClient.Set(ctx, fmt.Sprintf(KeyShowFormat, key), title, 0).Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to save show title to Redis: %v", err)
+	}
+
+	if err := s.redisClient.SAdd(ctx, KeyShows, key).Err(); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to add show to Redis watchlist: %v", err)
+	}
+
+	return s.getShow(ctx, key)
+}
+
+func (s *Service) RemoveShow(ctx context.Context, req *coordinatorpb.RemoveShowRequest) (*coordinatorpb.RemoveShowResponse, error) {
+	key := NormalizeTitle(req.Title)
+	log.Printf("Removing show from watchlist (key: %s)", key)
+
+	removed, err := s.redisClient.SRem(ctx, KeyShows, key).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to remove show from Redis watchlist: %v", err)
+	}
+
+	err = s.redisClient.Del(ctx, fmt.Sprintf(KeyShowFormat, key), fmt.Sprintf(KeyShowEpisodesFormat, key)).Err()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to delete show from Redis: %v", err)
+	}
+
+	return &coordinatorpb.RemoveShowResponse{Removed: removed > 0}, nil
+}
+
+func (s *Service) ListShows(ctx context.Context, req *coordinatorpb.ListShowsRequest) (*coordinatorpb.ListShowsResponse, error) {
+	keys, err := s.redisClient.SMembers(ctx, KeyShows).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get shows from Redis: %v", err)
+	}
+
+	shows := make([]*coordinatorpb.Show, 0, len(keys))
+	for _, key := range keys {
+		show, err := s.getShow(ctx, key)
+		if err != nil {
+			log.Printf("failed to get show (key: %s): %v", key, err)
+			continue
+		}
+		shows = append(shows, show)
+	}
+
+	sort.Slice(shows, func(i, j int) bool {
+		return strings.ToLower(shows[i].Title) < strings.ToLower(shows[j].Title)
+	})
+
+	return &coordinatorpb.ListShowsResponse{Shows: shows}, nil
+}
+
+func (s *Service) getShow(ctx context.Context, key string) (*coordinatorpb.Show, error) {
+	title, err := s.redisClient.Get(ctx, fmt.Sprintf(KeyShowFormat, key)).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get show title from Redis: %v", err)
+	}
+
+	episodeKeys, err := s.redisClient.SMembers(ctx, fmt.Sprintf(KeyShowEpisodesFormat, key)).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to get show episodes from Redis: %v", err)
+	}
+
+	downloaded := make([]Episode, 0, len(episodeKeys))
+	for _, episodeKey := range episodeKeys {
+		episode, err := ParseEpisodeKey(episodeKey)
+		if err != nil {
+			log.Printf("skipping episode of show %s: %v", key, err)
+			continue
+		}
+		downloaded = append(downloaded, episode)
+	}
+	SortEpisodes(downloaded)
+
+	return &coordinatorpb.Show{
+		Title:      title,
+		Downloaded: toPbEpisodes(downloaded),
+		Missing:    toPbEpisodes(MissingEpisodes(downloaded)),
+	}, nil
+}
+
+// checkDuplicateEpisodes refuses a release whose episodes of a watched show were all downloaded already
+func (s *Service) checkDuplicateEpisodes(ctx context.Context, category common.RequestType, name string) error {
+	if !isSeriesCategory(category) || name == "" {
+		return nil
+	}
+
+	key, episodes := ParseRelease(name)
+	if len(episodes) == 0 {
+		return nil
+	}
+
+	watched, err := s.redisClient.SIsMember(ctx, KeyShows, key).Result()
+	if err != nil || !watched {
+		return nil
+	}
+
+	members := make([]any, 0, len(episodes))
+	for _, e := range episodes {
+		members = append(members, e.String())
+	}
+
+	downloaded, err := s.redisClient.SMIsMember(ctx, fmt.Sprintf(KeyShowEpisodesFormat, key), members...).Result()
+	if err != nil {
+		log.Printf("failed to check downloaded episodes (show: %s): %v", key, err)
+		return nil
+	}
+
+	for _, isDownloaded := range downloaded {
+		if !isDownloaded {
+			return nil
+		}
+	}
+
+	log.Printf("All episodes already downloaded (show: %s, release: %s)", key, name)
+	return status.Errorf(codes.AlreadyExists, "episodes %s of %s are already downloaded", formatEpisodes(episodes), key)
+}
+
+// recordEpisodes marks the episodes of a completed release as downloaded if the show is watched
+func (s *Service) recordEpisodes(ctx context.Context, category common.RequestType, name string) {
+	if !isSeriesCategory(category) {
+		return
+	}
+
+	key, episodes := ParseRelease(name)
+	if len(episodes) == 0 {
+		return
+	}
+
+	watched, err := s.redisClient.SIsMember(ctx, KeyShows, key).Result()
+	if err != nil {
+		log.Printf("failed to check watchlist (show: %s): %v", key, err)
+		return
+	}
+	if !watched {
+		return
+	}
+
+	members := make([]any, 0, len(episodes))
+	for _, e := range episodes {
+		members = append(members, e.String())
+	}
+
+	if err := s.redisClient.SAdd(ctx, fmt.Sprintf(KeyShowEpisodesFormat, key), members...).Err(); err != nil {
+		log.Printf("failed to record episodes (show: %s): %v", key, err)
+		return
+	}
+
+	log.Printf("Episodes recorded (show: %s, episodes: %s)", key, formatEpisodes(episodes))
+}
+
+func isSeriesCategory(category common.RequestType) bool {
+	return category == common.RequestType_SERIES || category == common.RequestType_CARTOONS_SERIES
+}
+
+func formatEpisodes(episodes []Episode) string {
+	names := make([]string, 0, len(episodes))
+	for _, e := range episodes {
+		names = append(names, e.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+func toPbEpisodes(episodes []Episode) []*coordinatorpb.Episode {
+	result := make([]*coordinatorpb.Episode, 0, len(episodes))
+	for _, e := range episodes {
+		result = append(result, &coordinatorpb.Episode{Season: e.Season, Episode: e.Episode})
+	}
+	return result
+}
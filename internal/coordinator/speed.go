@@ -0,0 +1,53 @@
+package coordinator
+
+import (
+	"context"
+	"log"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *Service) GetSpeed(ctx context.Context, req *coordinatorpb.GetSpeedRequest) (*coordinatorpb.SpeedSettings, error) {
+	session, err := s.transmissionClient.GetSession(ctx, &transmission.GetSessionRequest{})
+	if err != nil {
+		log.Printf("failed to get transmission session: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get speed settings: %v", err)
+	}
+
+	return toPbSpeedSettings(session), nil
+}
+
+func (s *Service) SetSpeed(ctx context.Context, req *coordinatorpb.SetSpeedRequest) (*coordinatorpb.SpeedSettings, error) {
+	log.Printf("Updating speed settings: %v", req)
+
+	session, err := s.transmissionClient.SetSession(ctx, &transmission.SetSessionRequest{
+		AltSpeedEnabled:       req.AltSpeedEnabled,
+		SpeedLimitDownEnabled: req.SpeedLimitDownEnabled,
+		SpeedLimitDown:        req.SpeedLimitDown,
+		SpeedLimitUpEnabled:   req.SpeedLimitUpEnabled,
+		SpeedLimitUp:          req.SpeedLimitUp,
+	})
+	if err != nil {
+		log.Printf("failed to set transmission session: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to set speed settings: %v", err)
+	}
+
+	return toPbSpeedSettings(session), nil
+}
+
+func toPbSpeedSettings(session *transmission.SessionSettings) *coordinatorpb.SpeedSettings {
+	return &coordinatorpb.SpeedSettings{
+		AltSpeedEnabled:       session.AltSpeedEnabled,
+		SpeedLimitDownEnabled: session.SpeedLimitDownEnabled,
+		SpeedLimitDown:        session.SpeedLimitDown,
+		SpeedLimitUpEnabled:   session.SpeedLimitUpEnabled,
+		SpeedLimitUp:          session.SpeedLimitUp,
+		AltSpeedDown:          session.AltSpeedDown,
+		AltSpeedUp:            session.AltSpeedUp,
+		DownloadRate:          session.DownloadRate,
+		UploadRate:            session.UploadRate,
+	}
+}
@@ -0,0 +1,184 @@
+package coordinator
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// torrentFileMaxSize bounds the torrent files fetched to read their name
+	torrentFileMaxSize = 10 << 20
+	// torrentFileTimeout bounds fetching a torrent file to read its name
+	torrentFileTimeout = 30 * time.Second
+)
+
+var errInvalidTorrent = errors.New("invalid torrent file")
+
+// torrentLinkName returns the name of the torrent a magnet link or torrent file URL points to,
+// empty if it can't be told
+func torrentLinkName(ctx context.Context, link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	switch u.Scheme {
+	case "magnet":
+		return u.Query().Get("dn")
+	case "http", "https":
+		ctx, cancel := context.WithTimeout(ctx, torrentFileTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+		if err != nil {
+			return ""
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return ""
+		}
+
+		data, err := io.ReadAll(io.LimitReader(resp.Body, torrentFileMaxSize))
+		if err != nil {
+			return ""
+		}
+
+		name, _ := torrentFileName(data)
+		return name
+	default:
+		return ""
+	}
+}
+
+// base64TorrentName returns the name of a base64 encoded torrent file, empty if it can't be read
+func base64TorrentName(base64File string) string {
+	data, err := base64.StdEncoding.DecodeString(base64File)
+	if err != nil {
+		return ""
+	}
+
+	name, _ := torrentFileName(data)
+	return name
+}
+
+// torrentFileName reads the name of the info dictionary of a bencoded torrent file
+func torrentFileName(data []byte) (string, error) {
+	if len(data) == 0 || data[0] != 'd' {
+		return "", errInvalidTorrent
+	}
+
+	info, err := dictValue(data, "info")
+	if err != nil {
+		return "", err
+	}
+	if len(info) == 0 || info[0] != 'd' {
+		return "", errInvalidTorrent
+	}
+
+	for _, key := range []string{"name.utf-8", "name"} {
+		value, err := dictValue(info, key)
+		if err != nil {
+			continue
+		}
+
+		name, _, err := bencodeString(value)
+		if err == nil {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: no name", errInvalidTorrent)
+}
+
+// dictValue returns the raw bencoded value of a key of a bencoded dictionary
+func dictValue(dict []byte, key string) ([]byte, error) {
+	pos := 1
+	for pos < len(dict) && dict[pos] != 'e' {
+		k, n, err := bencodeString(dict[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += n
+
+		size, err := bencodeSize(dict[pos:])
+		if err != nil {
+			return nil, err
+		}
+
+		if k == key {
+			return dict[pos : pos+size], nil
+		}
+		pos += size
+	}
+
+	return nil, fmt.Errorf("%w: no %s", errInvalidTorrent, key)
+}
+
+// bencodeString decodes a bencoded string and returns it with its encoded size
+func bencodeString(data []byte) (string, int, error) {
+	for i, c := range data {
+		if c == ':' {
+			length, err := strconv.Atoi(string(data[:i]))
+			if err != nil || length < 0 || i+1+length > len(data) {
+				return "", 0, errInvalidTorrent
+			}
+			return string(data[i+1 : i+1+length]), i + 1 + length, nil
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+	}
+
+	return "", 0, errInvalidTorrent
+}
+
+// bencodeSize returns the encoded size of the bencoded value at the start of data
+func bencodeSize(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, errInvalidTorrent
+	}
+
+	switch c := data[0]; {
+	case c == 'i':
+		for i := 1; i < len(data); i++ {
+			if data[i] == 'e' {
+				return i + 1, nil
+			}
+		}
+		return 0, errInvalidTorrent
+
+	case c == 'l' || c == 'd':
+		pos := 1
+		for pos < len(data) && data[pos] != 'e' {
+			size, err := bencodeSize(data[pos:])
+			if err != nil {
+				return 0, err
+			}
+			pos += size
+		}
+		if pos >= len(data) {
+			return 0, errInvalidTorrent
+		}
+		return pos + 1, nil
+
+	case c >= '0' && c <= '9':
+		_, size, err := bencodeString(data)
+		return size, err
+
+	default:
+		return 0, errInvalidTorrent
+	}
+}
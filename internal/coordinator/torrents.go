@@ -0,0 +1,229 @@
+package coordinator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// torrentStates maps torrent client statuses to the states reported by ListTorrents
+var torrentStates = map[transmission.TorrentStatus]coordinatorpb.TorrentState{
+	transmission.TorrentStatus_STATUS_STOPPED:     coordinatorpb.TorrentState_TORRENT_STATE_STOPPED,
+	transmission.TorrentStatus_STATUS_IN_PROGRESS: coordinatorpb.TorrentState_TORRENT_STATE_DOWNLOADING,
+	transmission.TorrentStatus_STATUS_DONE:        coordinatorpb.TorrentState_TORRENT_STATE_DONE,
+	transmission.TorrentStatus_STATUS_ERROR:       coordinatorpb.TorrentState_TORRENT_STATE_ERROR,
+}
+
+// torrentState reports finished torrents stopped by their seed limit as done
+func torrentState(summary *transmission.TorrentSummary) coordinatorpb.TorrentState {
+	if summary.State == transmission.TorrentState_STATE_FINISHED {
+		return coordinatorpb.TorrentState_TORRENT_STATE_DONE
+	}
+	return torrentStates[summary.Status]
+}
+
+// filterByState keeps the torrents reported in the given state, all of them if the state is unspecified.
+// Torrents are filtered on the reported state since a finished torrent is done whatever its client status.
+func filterByState(summaries []*transmission.TorrentSummary, state coordinatorpb.TorrentState) []*transmission.TorrentSummary {
+	if state == coordinatorpb.TorrentState_TORRENT_STATE_UNSPECIFIED {
+		return summaries
+	}
+
+	var filtered []*transmission.TorrentSummary
+	for _, summary := range summaries {
+		if torrentState(summary) == state {
+			filtered = append(filtered, summary)
+		}
+	}
+	return filtered
+}
+
+// adoptLockTTL bounds how long a torrent stays locked if the coordinator stops while adopting it
+const adoptLockTTL = 1 * time.Minute
+
+// trackedTorrent is a torrent that belongs to a bot request
+type trackedTorrent struct {
+	requestID string
+	category  common.RequestType
+}
+
+func (s *Service) ListTorrents(ctx context.Context, req *coordinatorpb.ListTorrentsRequest) (*coordinatorpb.ListTorrentsResponse, error) {
+	resp, err := s.transmissionClient.ListTorrents(ctx, &transmission.ListTorrentsRequest{Label: req.Label})
+	if err != nil {
+		log.Printf("failed to list torrents: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to list torrents: %v", err)
+	}
+
+	summaries := filterByState(resp.Torrents, req.State)
+	total := int32(len(summaries))
+	if req.Offset > 0 {
+		summaries = summaries[min(int(req.Offset), len(summaries)):]
+	}
+	if req.Limit > 0 {
+		summaries = summaries[:min(int(req.Limit), len(summaries))]
+	}
+
+	tracked := s.trackedTorrents(ctx)
+	torrents := make([]*coordinatorpb.Torrent, 0, len(summaries))
+	for _, summary := range summaries {
+		torrent := &coordinatorpb.Torrent{
+			TorrentId: summary.TorrentId,
+			Name:      summary.Name,
+			State:     torrentState(summary),
+			Progress:  summary.Progress,
+			SizeBytes: summary.SizeBytes,
+			Labels:    summary.Labels,
+		}
+		if t, ok := tracked[summary.TorrentId]; ok {
+			torrent.RequestId = t.requestID
+			torrent.Category = t.category
+		}
+		torrents = append(torrents, torrent)
+	}
+
+	return &coordinatorpb.ListTorrentsResponse{
+		Torrents: torrents,
+		Total:    total,
+	}, nil
+}
+
+func (s *Service) AdoptTorrent(ctx context.Context, req *coordinatorpb.AdoptTorrentRequest) (*coordinatorpb.DownloadResponse, error) {
+	log.Printf("Adopting torrent (requestID: %s, torrentID: %d, category: %s)", req.RequestId, req.TorrentId, req.Category)
+
+	if _, ok := s.pbTypeToDownloadPath[req.Category]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown category %s", req.Category)
+	}
+
+	// The lock keeps a concurrent adoption of the same torrent from passing the tracked check too
+	lockKey := fmt.Sprintf(KeyAdoptLockFormat, req.TorrentId)
+	locked, err := s.redisClient.SetNX(ctx, lockKey, req.RequestId, adoptLockTTL).Result()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to lock torrent: %v", err)
+	}
+	if !locked {
+		return nil, status.Error(codes.AlreadyExists, "torrent is being adopted by another request")
+	}
+	defer s.redisClient.Del(context.Background(), lockKey)
+
+	if t, ok := s.trackedTorrents(ctx)[req.TorrentId]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "torrent already belongs to request %s", t.requestID)
+	}
+
+	// Plex only scans the category directory, the data isn't moved there
+	files, err := s.transmissionClient.GetTorrentFiles(ctx, &transmission.GetTorrentFilesRequest{TorrentId: req.TorrentId})
+	if err != nil {
+		log.Printf("failed to get torrent files (requestID: %s): %v", req.RequestId, err)
+		return nil, err
+	}
+	if categoryDir := s.pbTypeToDownloadPath[req.Category]; !isSameOrInside(files.DownloadDir, categoryDir) {
+		return nil, status.Errorf(codes.FailedPrecondition, "the torrent is saved in %s, outside the %s directory %s; move it there in Transmission first",
+			files.DownloadDir, req.Category, categoryDir)
+	}
+
+	statusResp, err := s.transmissionClient.GetTorrentStatus(ctx, &transmission.GetTorrentStatusRequest{
+		TorrentId: req.TorrentId,
+		RequestId: req.RequestId,
+	})
+	if err != nil {
+		log.Printf("failed to get torrent status (requestID: %s): %v", req.RequestId, err)
+		return nil, err
+	}
+
+	// A stopped torrent would be reported as failed right away
+	if statusResp.Status == transmission.TorrentStatus_STATUS_STOPPED {
+		_, err := s.transmissionClient.StartTorrents(ctx, &transmission.StartTorrentsRequest{TorrentIds: []int64{req.TorrentId}})
+		if err != nil {
+			log.Printf("failed to start adopted torrent (requestID: %s): %v", req.RequestId, err)
+			return nil, status.Errorf(codes.Internal, "failed to start torrent: %v", err)
+		}
+	}
+
+	record := &TorrentRecord{
+		TorrentID: req.TorrentId,
+		Category:  req.Category,
+		Name:      statusResp.Name,
+	}
+	err = s.redisClient.HSet(ctx, fmt.Sprintf(KeyTorrentFormat, req.RequestId), record.ToRedisMap()).Err()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to save to Redis torrent record: %v", err)
+	}
+
+	err = s.redisClient.SAdd(ctx, KeyTorrentInProgress, req.RequestId).Err()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to add to Redis requestID to in progress set: %v", err)
+	}
+	s.wakeProgressChecker()
+
+	log.Printf("Torrent adopted (requestID: %s, torrentID: %d)", req.RequestId, req.TorrentId)
+	s.saveRequester(ctx, req.RequestId, req.Requester)
+	s.appendHistory(ctx, req.RequestId, fmt.Sprintf("Adopted from Transmission: %s (id: %d)", statusResp.Name, req.TorrentId))
+
+	return &coordinatorpb.DownloadResponse{
+		Name:      statusResp.Name,
+		RequestId: req.RequestId,
+		Progress:  statusResp.Progress,
+		Status:    coordinatorpb.DownloadStatus_DOWNLOAD_STATUS_IN_PROGRESS,
+		Message:   "📥 Torrent adopted",
+	}, nil
+}
+
+// isSameOrInside reports whether path is dir or a path inside it
+func isSameOrInside(path string, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// trackedRequestIDs returns the requests that are in progress, seeding, scheduled or queued.
+// On errors, the requests of the sets that could be read are returned with the first error.
+func (s *Service) trackedRequestIDs(ctx context.Context) ([]string, error) {
+	var requestIDs []string
+	var firstErr error
+	for _, key := range []string{KeyTorrentInProgress, KeyTorrentFinishing, KeyTorrentSeeding} {
+		members, err := s.redisClient.SMembers(ctx, key).Result()
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to get %s: %w", key, err)
+		}
+		requestIDs = append(requestIDs, members...)
+	}
+	for _, key := range []string{KeyTorrentScheduled, KeyTorrentQueued} {
+		members, err := s.redisClient.ZRange(ctx, key, 0, -1).Result()
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to get %s: %w", key, err)
+		}
+		requestIDs = append(requestIDs, members...)
+	}
+
+	return requestIDs, firstErr
+}
+
+// trackedTorrents returns the torrents of every known request, by torrent ID
+func (s *Service) trackedTorrents(ctx context.Context) map[int64]trackedTorrent {
+	requestIDs, err := s.trackedRequestIDs(ctx)
+	if err != nil {
+		log.Printf("failed to get tracked requests: %v", err)
+	}
+
+	records, err := s.getTorrentRecords(ctx, requestIDs)
+	if err != nil {
+		log.Printf("failed to get tracked torrents: %v", err)
+	}
+
+	tracked := make(map[int64]trackedTorrent, len(records))
+	for requestID, record := range records {
+		if record.URL != "" {
+			continue
+		}
+		tracked[record.TorrentID] = trackedTorrent{requestID: requestID, category: record.Category}
+	}
+
+	return tracked
+}
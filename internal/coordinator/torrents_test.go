@@ -0,0 +1,62 @@
+package coordinator
+
+import (
+	"slices"
+	"testing"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+func TestFilterByState(t *testing.T) {
+	summaries := []*transmission.TorrentSummary{
+		{TorrentId: 1, Status: transmission.TorrentStatus_STATUS_IN_PROGRESS, State: transmission.TorrentState_STATE_DOWNLOADING},
+		{TorrentId: 2, Status: transmission.TorrentStatus_STATUS_DONE, State: transmission.TorrentState_STATE_SEEDING},
+		// Stopped by its seed limit, reported as done
+		{TorrentId: 3, Status: transmission.TorrentStatus_STATUS_STOPPED, State: transmission.TorrentState_STATE_FINISHED},
+		{TorrentId: 4, Status: transmission.TorrentStatus_STATUS_STOPPED, State: transmission.TorrentState_STATE_PAUSED},
+		{TorrentId: 5, Status: transmission.TorrentStatus_STATUS_ERROR, State: transmission.TorrentState_STATE_ERROR},
+	}
+
+	ids := func(state coordinatorpb.TorrentState) []int64 {
+		var ids []int64
+		for _, summary := range filterByState(summaries, state) {
+			if got := torrentState(summary); state != coordinatorpb.TorrentState_TORRENT_STATE_UNSPECIFIED && got != state {
+				t.Errorf("torrent %d is listed as %s under the %s filter", summary.TorrentId, got, state)
+			}
+			ids = append(ids, summary.TorrentId)
+		}
+		return ids
+	}
+
+	if got := ids(coordinatorpb.TorrentState_TORRENT_STATE_DONE); !slices.Equal(got, []int64{2, 3}) {
+		t.Errorf("DONE filter = %v, want the seeding and the finished stopped torrents [2 3]", got)
+	}
+	if got := ids(coordinatorpb.TorrentState_TORRENT_STATE_STOPPED); !slices.Equal(got, []int64{4}) {
+		t.Errorf("STOPPED filter = %v, want only the paused torrent [4]", got)
+	}
+	if got := ids(coordinatorpb.TorrentState_TORRENT_STATE_ERROR); !slices.Equal(got, []int64{5}) {
+		t.Errorf("ERROR filter = %v, want [5]", got)
+	}
+	if got := ids(coordinatorpb.TorrentState_TORRENT_STATE_UNSPECIFIED); len(got) != len(summaries) {
+		t.Errorf("no filter = %v, want every torrent", got)
+	}
+}
+
+func TestIsSameOrInside(t *testing.T) {
+	categoryDir := "/downloads/films"
+
+	for dir, want := range map[string]bool{
+		"/downloads/films":               true,
+		"/downloads/films/":              true,
+		"/downloads/films/Movie (2019)":  true,
+		"/downloads/films/../series":     false,
+		"/downloads/films2":              false,
+		"/downloads":                     false,
+		"/downloads/series/Show (2020)/": false,
+	} {
+		if got := isSameOrInside(dir, categoryDir); got != want {
+			t.Errorf("isSameOrInside(%q, %q) = %v, want %v", dir, categoryDir, got, want)
+		}
+	}
+}
@@ -1,13 +1,59 @@
 package coordinator
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
 	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
 )
 
+// Options holds optional coordinator settings
+type Options struct {
+	// DownloadWindows are the daily windows in which downloads scheduled "for the window" start
+	DownloadWindows []TimeWindow
+	// AltSpeedWindows are the daily windows in which Transmission alt-speed (turtle) mode is on
+	AltSpeedWindows []TimeWindow
+	// MaxActiveDownloads limits the number of downloads running at once, 0 means unlimited
+	MaxActiveDownloads int
+	// MaxActiveDownloadsPerCategory limits running downloads per category, 0 means unlimited
+	MaxActiveDownloadsPerCategory map[common.RequestType]int
+	// MinFreeSpaceBytes is the free space to keep in download directories
+	MinFreeSpaceBytes int64
+	// DiskSpacePolicy defines whether downloads that don't fit are refused or only warned about
+	DiskSpacePolicy DiskSpacePolicy
+	// SeedingRules are the per-category seeding targets, the unspecified category is the default
+	SeedingRules map[common.RequestType]SeedingRule
+	// RemoveAfterSeeding removes torrents (keeping the files) from Transmission once their seeding rule is met
+	RemoveAfterSeeding bool
+	// ImportMode defines how completed files are organized into Plex naming conventions
+	ImportMode ImportMode
+	// PathMapping translates Transmission paths into paths mounted in the coordinator, used by the import
+	PathMapping paths.Mapping
+	// ExtractArchives extracts zip and rar archives of completed downloads before the Plex refresh
+	ExtractArchives bool
+	// PlexConfirmTimeout is how long to wait for a download to appear in Plex, 0 disables the check
+	PlexConfirmTimeout time.Duration
+}
+
 // TorrentRecord represents a torrent download record stored in Redis
 type TorrentRecord struct {
 	TorrentID int64
 	Category  common.RequestType
+	Name      string
+	Priority  coordinatorpb.DownloadPriority
+	QueuedAt  int64
+	// SpaceChecked is set once the torrent size was compared with the free space
+	SpaceChecked bool
+	// Warning is a non-fatal problem reported with every progress update
+	Warning string
+	// URL is set for direct HTTP downloads, which have no torrent ID
+	URL string
+	// UpdatedAt is the Unix time the progress checker last got the status of the download,
+	// it is written by the checker only
+	UpdatedAt int64
 }
 
 // ToRedisMap converts TorrentRecord to a map of field-value pairs for Redis
@@ -15,5 +61,56 @@ func (r *TorrentRecord) ToRedisMap() map[string]any {
 	return map[string]any{
 		"torrent_id": r.TorrentID,
 		"category":   int32(r.Category),
+		"name":       r.Name,
+		"priority":   int32(r.Priority),
+		"queued_at":  r.QueuedAt,
+		"url":        r.URL,
 	}
 }
+
+// FromRedisMap fills TorrentRecord from a Redis hash
+func (r *TorrentRecord) FromRedisMap(m map[string]string) error {
+	torrentID, err := strconv.ParseInt(m["torrent_id"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid torrent_id: %s", m["torrent_id"])
+	}
+	r.TorrentID = torrentID
+
+	category, err := strconv.ParseInt(m["category"], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid category: %s", m["category"])
+	}
+	r.Category = common.RequestType(category)
+
+	r.Name = m["name"]
+
+	if priority, ok := m["priority"]; ok {
+		value, err := strconv.ParseInt(priority, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid priority: %s", priority)
+		}
+		r.Priority = coordinatorpb.DownloadPriority(value)
+	}
+
+	if queuedAt, ok := m["queued_at"]; ok {
+		value, err := strconv.ParseInt(queuedAt, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid queued_at: %s", queuedAt)
+		}
+		r.QueuedAt = value
+	}
+
+	r.SpaceChecked = m["space_checked"] == "1"
+	r.Warning = m["warning"]
+	r.URL = m["url"]
+
+	if updatedAt, ok := m["updated_at"]; ok {
+		value, err := strconv.ParseInt(updatedAt, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid updated_at: %s", updatedAt)
+		}
+		r.UpdatedAt = value
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package coordinator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	coordinatorpb "github.com/aquare11e/media-downloader-bot/common/protogen/coordinator"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// watchBlockTimeout bounds each blocking stream read, so that closed watchers are noticed
+	watchBlockTimeout = 5 * time.Second
+	// watchBatchSize is the number of progress updates read from the stream at once
+	watchBatchSize = 100
+)
+
+// cursorPattern matches Redis stream IDs, e.g. 1718000000000-0
+var cursorPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+// saveRequester remembers who asked for a download, so that its streamed updates can be filtered
+func (s *Service) saveRequester(ctx context.Context, requestID string, requester string) {
+	if requester == "" {
+		return
+	}
+
+	err := s.redisClient.Set(ctx, fmt.Sprintf(KeyTorrentRequesterFormat, requestID), requester, HistoryTTL).Err()
+	if err != nil {
+		log.Printf("failed to save requester (requestID: %s): %v", requestID, err)
+	}
+}
+
+// requester returns who asked for a download, empty if unknown
+func (s *Service) requester(ctx context.Context, requestID string) string {
+	requester, err := s.redisClient.Get(ctx, fmt.Sprintf(KeyTorrentRequesterFormat, requestID)).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		log.Printf("failed to get requester (requestID: %s): %v", requestID, err)
+	}
+	return requester
+}
+
+func (s *Service) WatchDownloads(req *coordinatorpb.WatchDownloadsRequest, stream coordinatorpb.CoordinatorService_WatchDownloadsServer) error {
+	ctx := stream.Context()
+
+	cursor := req.Cursor
+	if cursor == "" {
+		// Start after the latest update, "$" can't be used as it would skip updates between reads
+		latest, err := s.redisClient.XRevRangeN(ctx, KeyDownloadEvents, "+", "-", 1).Result()
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to get latest progress update from Redis: %v", err)
+		}
+
+		cursor = "0"
+		if len(latest) > 0 {
+			cursor = latest[0].ID
+		}
+	} else if !cursorPattern.MatchString(cursor) {
+		return status.Errorf(codes.InvalidArgument, "invalid cursor: %s", cursor)
+	}
+
+	requestIDs := make(map[string]bool, len(req.RequestIds))
+	for _, requestID := range req.RequestIds {
+		requestIDs[requestID] = true
+	}
+
+	log.Printf("Watching downloads (cursor: %s, requester: %s, requestIDs: %d)", cursor, req.Requester, len(requestIDs))
+
+	for {
+		streams, err := s.redisClient.XRead(ctx, &redis.XReadArgs{
+			Streams: []string{KeyDownloadEvents, cursor},
+			Count:   watchBatchSize,
+			Block:   watchBlockTimeout,
+		}).Result()
+		if ctx.Err() != nil {
+			log.Printf("Download watcher closed (cursor: %s)", cursor)
+			return nil
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return status.Errorf(codes.Internal, "failed to read progress updates from Redis: %v", err)
+		}
+
+		for _, message := range streams[0].Messages {
+			cursor = message.ID
+
+			progress, err := decodeDownloadEvent(message)
+			if err != nil {
+				log.Printf("failed to decode progress update %s: %v", message.ID, err)
+				continue
+			}
+
+			if len(requestIDs) > 0 && !requestIDs[progress.RequestId] {
+				continue
+			}
+			if req.Requester != "" && progress.Requester != req.Requester {
+				continue
+			}
+
+			if err := stream.Send(&coordinatorpb.DownloadEvent{Cursor: message.ID, Download: progress}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func decodeDownloadEvent(message redis.XMessage) (*coordinatorpb.DownloadResponse, error) {
+	data, ok := message.Values["data"].(string)
+	if !ok {
+		return nil, errors.New("missing data field")
+	}
+
+	progress := &coordinatorpb.DownloadResponse{}
+	if err := proto.Unmarshal([]byte(data), progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
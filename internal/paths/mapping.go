@@ -0,0 +1,41 @@
+package paths
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Mapping translates download paths as seen by Transmission into paths as seen by another service
+type Mapping struct {
+	From string
+	To   string
+}
+
+// ParseMapping parses a FROM:TO path prefix mapping, empty means paths are the same
+func ParseMapping(value string) (Mapping, error) {
+	if value == "" {
+		return Mapping{}, nil
+	}
+
+	from, to, ok := strings.Cut(value, ":")
+	if !ok || from == "" || to == "" {
+		return Mapping{}, fmt.Errorf("invalid path mapping %q: expected FROM:TO", value)
+	}
+
+	return Mapping{From: filepath.Clean(from), To: filepath.Clean(to)}, nil
+}
+
+// Apply translates a download path, paths outside the mapped prefix are returned unchanged
+func (m Mapping) Apply(path string) string {
+	if m.From == "" {
+		return path
+	}
+
+	rel, err := filepath.Rel(m.From, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+
+	return filepath.Join(m.To, rel)
+}
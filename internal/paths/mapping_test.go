@@ -0,0 +1,43 @@
+package paths
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ExampleMapping_Apply() {
+	// Transmission saves to /downloads, Plex sees the same disk at /data
+	mapping, _ := ParseMapping("/downloads/:/data")
+
+	fmt.Println(mapping.Apply("/downloads/films/Movie (2019)"))
+	fmt.Println(mapping.Apply("/downloads"))
+	// Paths outside the mapped prefix, even with the same leading characters, are kept
+	fmt.Println(mapping.Apply("/downloads2/films"))
+	fmt.Println(mapping.Apply("/media/films"))
+	// Output:
+	// /data/films/Movie (2019)
+	// /data
+	// /downloads2/films
+	// /media/films
+}
+
+func TestEmptyMappingKeepsPaths(t *testing.T) {
+	mapping, err := ParseMapping("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/downloads/films", "films/Movie", ""} {
+		if got := mapping.Apply(path); got != path {
+			t.Errorf("Apply(%q) = %q, an empty mapping should keep paths", path, got)
+		}
+	}
+}
+
+func TestParseMappingRejectsHalfMappings(t *testing.T) {
+	for _, value := range []string{"/downloads", ":/data", "/downloads:"} {
+		if _, err := ParseMapping(value); err == nil {
+			t.Errorf("ParseMapping(%q) should fail", value)
+		}
+	}
+}
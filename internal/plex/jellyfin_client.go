@@ -0,0 +1,192 @@
+package plex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
+)
+
+// JellyfinClient is a Jellyfin or Emby client, both share the same library API
+type JellyfinClient struct {
+	baseURL           string
+	apiKey            string
+	emby              bool
+	pbTypeToLibraryId map[common.RequestType]string
+	pathMapping       paths.Mapping
+	httpClient        *http.Client
+}
+
+// NewJellyfinClient creates a new Jellyfin client, or an Emby client if emby is set
+func NewJellyfinClient(baseURL string, apiKey string, emby bool, pathMapping paths.Mapping) *JellyfinClient {
+	return &JellyfinClient{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		apiKey:      apiKey,
+		emby:        emby,
+		pathMapping: pathMapping,
+		httpClient:  &http.Client{},
+	}
+}
+
+type virtualFolder struct {
+	Name           string   `json:"Name"`
+	ItemId         string   `json:"ItemId"`
+	CollectionType string   `json:"CollectionType"`
+	Locations      []string `json:"Locations"`
+}
+
+type itemsResponse struct {
+	Items []struct {
+		Id             string `json:"Id"`
+		Name           string `json:"Name"`
+		Type           string `json:"Type"`
+		ProductionYear int32  `json:"ProductionYear"`
+		Path           string `json:"Path"`
+		DateCreated    string `json:"DateCreated"`
+		SeriesId       string `json:"SeriesId"`
+		SeriesName     string `json:"SeriesName"`
+	} `json:"Items"`
+}
+
+// DiscoverSections maps each category to a library and uses the mapping for scans
+func (c *JellyfinClient) DiscoverSections(ctx context.Context, configured map[common.RequestType]string, downloadPaths map[common.RequestType]string) error {
+	var folders []virtualFolder
+	if err := c.do(ctx, http.MethodGet, "/Library/VirtualFolders", nil, &folders); err != nil {
+		return fmt.Errorf("failed to list libraries: %w", err)
+	}
+
+	sections := make([]Section, 0, len(folders))
+	for _, f := range folders {
+		sections = append(sections, Section{Key: f.ItemId, Title: f.Name, Type: f.CollectionType, Locations: f.Locations})
+	}
+
+	pbTypeToLibraryId, err := mapSections(sections, configured, downloadPaths, c.pathMapping)
+	if err != nil {
+		return err
+	}
+
+	c.pbTypeToLibraryId = pbTypeToLibraryId
+	return nil
+}
+
+// ScanLibrary refreshes the library of a category, only the given folder if path is not empty
+func (c *JellyfinClient) ScanLibrary(ctx context.Context, pbType common.RequestType, path string) error {
+	libraryId, ok := c.pbTypeToLibraryId[pbType]
+	if !ok {
+		return fmt.Errorf("library id not found for pb type: %d", pbType)
+	}
+
+	if path != "" {
+		body := map[string]any{
+			"Updates": []map[string]string{{"Path": c.pathMapping.Apply(path), "UpdateType": "Created"}},
+		}
+		return c.do(ctx, http.MethodPost, "/Library/Media/Updated", body, nil)
+	}
+
+	return c.do(ctx, http.MethodPost, fmt.Sprintf("/Items/%s/Refresh?Recursive=true", libraryId), nil, nil)
+}
+
+// FindRecentItem looks for a recently added item with a file at or under path, added at or after since.
+// Episodes resolve to their series. It returns nil if there is no such item yet.
+func (c *JellyfinClient) FindRecentItem(ctx context.Context, pbType common.RequestType, path string, since int64) (*Item, error) {
+	libraryId, ok := c.pbTypeToLibraryId[pbType]
+	if !ok {
+		return nil, fmt.Errorf("library id not found for pb type: %d", pbType)
+	}
+
+	query := url.Values{
+		"ParentId":         {libraryId},
+		"Recursive":        {"true"},
+		"IncludeItemTypes": {"Movie,Episode,Video"},
+		"SortBy":           {"DateCreated"},
+		"SortOrder":        {"Descending"},
+		"Fields":           {"Path,DateCreated,ProductionYear"},
+		"Limit":            {"50"},
+	}
+
+	var resp itemsResponse
+	if err := c.do(ctx, http.MethodGet, "/Items?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	folder := filepath.Clean(c.pathMapping.Apply(path))
+	for _, item := range resp.Items {
+		created, err := time.Parse(time.RFC3339Nano, item.DateCreated)
+		if err != nil || created.Unix() < since {
+			continue
+		}
+
+		if item.Path != folder && !strings.HasPrefix(item.Path, folder+"/") {
+			continue
+		}
+
+		if item.Type == "Episode" && item.SeriesId != "" {
+			return &Item{ID: item.SeriesId, Title: item.SeriesName}, nil
+		}
+		return &Item{ID: item.Id, Title: item.Name, Year: item.ProductionYear}, nil
+	}
+
+	return nil, nil
+}
+
+// ItemURL returns the web app link to an item
+func (c *JellyfinClient) ItemURL(ctx context.Context, id string) (string, error) {
+	if c.emby {
+		return fmt.Sprintf("%s/web/index.html#!/item?id=%s", c.baseURL, url.QueryEscape(id)), nil
+	}
+	return fmt.Sprintf("%s/web/#/details?id=%s", c.baseURL, url.QueryEscape(id)), nil
+}
+
+func (c *JellyfinClient) do(ctx context.Context, method string, path string, body any, v any) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Emby-Token", c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("media server rejected the API key (status code: %d), check JELLYFIN_API_KEY", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
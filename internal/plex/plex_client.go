@@ -2,38 +2,65 @@ package plex
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
 )
 
+// MediaServer is a media server whose library sections are refreshed when downloads complete
+type MediaServer interface {
+	// DiscoverSections maps each category to a library section
+	DiscoverSections(ctx context.Context, configured map[common.RequestType]string, downloadPaths map[common.RequestType]string) error
+	// ScanLibrary scans the section of a category, only the given folder if path is not empty
+	ScanLibrary(ctx context.Context, pbType common.RequestType, path string) error
+	// FindRecentItem looks for a recently added item with a file at or under path, added at or after since
+	FindRecentItem(ctx context.Context, pbType common.RequestType, path string, since int64) (*Item, error)
+	// ItemURL returns the web app link to an item
+	ItemURL(ctx context.Context, id string) (string, error)
+}
+
 // Client represents a Plex client
 type Client struct {
 	baseURL            string
 	token              string
 	pbTypeToCategoryId map[common.RequestType]string
+	pathMapping        paths.Mapping
 	httpClient         *http.Client
+
+	// machineIdentifier is read once from the server, confirmations of concurrent downloads share it
+	identifierMu      sync.Mutex
+	machineIdentifier string
 }
 
 // NewClient creates a new Plex client
-func NewClient(baseURL string, token string, pbTypeToCategoryId map[common.RequestType]string) *Client {
+func NewClient(baseURL string, token string, pbTypeToCategoryId map[common.RequestType]string, pathMapping paths.Mapping) *Client {
 	return &Client{
 		baseURL:            baseURL,
 		token:              token,
 		pbTypeToCategoryId: pbTypeToCategoryId,
+		pathMapping:        pathMapping,
 		httpClient:         &http.Client{},
 	}
 }
 
-// ScanLibrary scans a single Plex library
-func (c *Client) ScanLibrary(ctx context.Context, pbType common.RequestType) error {
+// ScanLibrary scans a single Plex library, only the given folder if path is not empty
+func (c *Client) ScanLibrary(ctx context.Context, pbType common.RequestType, path string) error {
 	categoryId, ok := c.pbTypeToCategoryId[pbType]
 	if !ok {
 		return fmt.Errorf("category id not found for pb type: %d", pbType)
 	}
 
 	scanURL := fmt.Sprintf("%s/library/sections/%s/refresh?X-Plex-Token=%s", c.baseURL, categoryId, c.token)
+	if path != "" {
+		scanURL += "&path=" + url.QueryEscape(c.pathMapping.Apply(path))
+	}
 
 	// Create the request
 	req, err := http.NewRequestWithContext(ctx, "GET", scanURL, nil)
@@ -55,3 +82,129 @@ func (c *Client) ScanLibrary(ctx context.Context, pbType common.RequestType) err
 
 	return nil
 }
+
+// Item is a movie or show in a library
+type Item struct {
+	// ID is the Plex rating key or the Jellyfin/Emby item ID
+	ID    string
+	Title string
+	Year  int32
+}
+
+type metadataResponse struct {
+	MediaContainer struct {
+		Metadata []struct {
+			RatingKey            string `json:"ratingKey"`
+			Type                 string `json:"type"`
+			Title                string `json:"title"`
+			Year                 int32  `json:"year"`
+			GrandparentTitle     string `json:"grandparentTitle"`
+			GrandparentRatingKey string `json:"grandparentRatingKey"`
+			AddedAt              int64  `json:"addedAt"`
+			Media                []struct {
+				Part []struct {
+					File string `json:"file"`
+				} `json:"Part"`
+			} `json:"Media"`
+		} `json:"Metadata"`
+	} `json:"MediaContainer"`
+}
+
+type identityResponse struct {
+	MediaContainer struct {
+		MachineIdentifier string `json:"machineIdentifier"`
+	} `json:"MediaContainer"`
+}
+
+// FindRecentItem looks for a recently added item with a file at or under path, added at or after since.
+// Episodes resolve to their show. It returns nil if there is no such item yet.
+func (c *Client) FindRecentItem(ctx context.Context, pbType common.RequestType, path string, since int64) (*Item, error) {
+	categoryId, ok := c.pbTypeToCategoryId[pbType]
+	if !ok {
+		return nil, fmt.Errorf("category id not found for pb type: %d", pbType)
+	}
+
+	var resp metadataResponse
+	if err := c.getJSON(ctx, fmt.Sprintf("/library/sections/%s/recentlyAdded", categoryId), &resp); err != nil {
+		return nil, err
+	}
+
+	// path is the downloaded file for single-file downloads, so that other recent items of the folder don't match
+	folder := filepath.Clean(c.pathMapping.Apply(path))
+	for _, m := range resp.MediaContainer.Metadata {
+		if m.AddedAt < since {
+			continue
+		}
+
+		for _, media := range m.Media {
+			for _, part := range media.Part {
+				if part.File != folder && !strings.HasPrefix(part.File, folder+"/") {
+					continue
+				}
+
+				if m.Type == "episode" {
+					return &Item{ID: m.GrandparentRatingKey, Title: m.GrandparentTitle}, nil
+				}
+				return &Item{ID: m.RatingKey, Title: m.Title, Year: m.Year}, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// ItemURL returns the Plex web app link to an item
+func (c *Client) ItemURL(ctx context.Context, id string) (string, error) {
+	machineIdentifier, err := c.getMachineIdentifier(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	key := url.QueryEscape("/library/metadata/" + id)
+	return fmt.Sprintf("https://app.plex.tv/desktop/#!/server/%s/details?key=%s", machineIdentifier, key), nil
+}
+
+// getMachineIdentifier returns the server's machine identifier, fetching it on first use. A failed
+// fetch is retried on the next call.
+func (c *Client) getMachineIdentifier(ctx context.Context) (string, error) {
+	c.identifierMu.Lock()
+	defer c.identifierMu.Unlock()
+
+	if c.machineIdentifier == "" {
+		var resp identityResponse
+		if err := c.getJSON(ctx, "/identity", &resp); err != nil {
+			return "", err
+		}
+		c.machineIdentifier = resp.MediaContainer.MachineIdentifier
+	}
+
+	return c.machineIdentifier, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s?X-Plex-Token=%s", c.baseURL, path, c.token), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("plex rejected the token (status code: %d), check PLEX_TOKEN", resp.StatusCode)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -3,28 +3,41 @@ package plex
 import (
 	"context"
 	"log"
+	"time"
 
-	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
 	protoPlex "github.com/aquare11e/media-downloader-bot/common/protogen/plex"
 )
 
+const (
+	findItemInterval = 5 * time.Second
+)
+
 type PlexService struct {
 	protoPlex.UnimplementedPlexServiceServer
-	client *Client
+	server MediaServer
 }
 
-func NewPlexService(baseURL string, token string, pbTypeToCategoryId map[common.RequestType]string) *PlexService {
-	client := NewClient(baseURL, token, pbTypeToCategoryId)
+func NewPlexService(server MediaServer) *PlexService {
 	return &PlexService{
-		client: client,
+		server: server,
 	}
 }
 
 func (s *PlexService) UpdateCategory(ctx context.Context, in *protoPlex.UpdateCategoryRequest) (*protoPlex.UpdateCategoryResponse, error) {
-	log.Printf("Received UpdateCategory request: id: %s, type: %v", in.RequestId, in.Type)
+	log.Printf("Received UpdateCategory request: id: %s, type: %v, path: %s", in.RequestId, in.Type, in.Path)
+
+	// Scan only the downloaded folder, falling back to the whole section
+	var err error
+	if in.Path != "" {
+		err = s.server.ScanLibrary(ctx, in.Type, in.Path)
+		if err != nil {
+			log.Printf("Failed to scan folder, scanning the whole section: %v", err)
+		}
+	}
 
-	// Call the ScanLibrary method or any other relevant method to update the category
-	err := s.client.ScanLibrary(ctx, in.Type)
+	if in.Path == "" || err != nil {
+		err = s.server.ScanLibrary(ctx, in.Type, "")
+	}
 	if err != nil {
 		log.Printf("Failed to update category: %v", err)
 		return nil, err
@@ -37,3 +50,43 @@ func (s *PlexService) UpdateCategory(ctx context.Context, in *protoPlex.UpdateCa
 		Message:   "Category updated successfully",
 	}, nil
 }
+
+func (s *PlexService) FindItem(ctx context.Context, in *protoPlex.FindItemRequest) (*protoPlex.FindItemResponse, error) {
+	log.Printf("Received FindItem request: id: %s, type: %v, path: %s", in.RequestId, in.Type, in.Path)
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(in.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	ticker := time.NewTicker(findItemInterval)
+	defer ticker.Stop()
+
+	for {
+		item, err := s.server.FindRecentItem(ctx, in.Type, in.Path, in.AddedSince)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to look for item: %v", err)
+		}
+
+		if item != nil {
+			link, err := s.server.ItemURL(ctx, item.ID)
+			if err != nil {
+				log.Printf("Failed to build item link: %v", err)
+			}
+
+			log.Printf("Item found (id: %s): %s (%d)", in.RequestId, item.Title, item.Year)
+			return &protoPlex.FindItemResponse{
+				RequestId: in.RequestId,
+				Found:     true,
+				Title:     item.Title,
+				Year:      item.Year,
+				Url:       link,
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Printf("Item not found before timeout (id: %s)", in.RequestId)
+			return &protoPlex.FindItemResponse{RequestId: in.RequestId}, nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package plex
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
+)
+
+// defaultSectionNames are the section titles matched to a category when nothing else matches
+var defaultSectionNames = map[common.RequestType][]string{
+	common.RequestType_FILMS:           {"films", "movies", "film", "movie"},
+	common.RequestType_SERIES:          {"series", "tv shows", "tv series", "shows", "tv"},
+	common.RequestType_CARTOONS:        {"cartoons", "animation", "animated movies"},
+	common.RequestType_CARTOONS_SERIES: {"cartoon series", "cartoons series", "animated series", "kids tv"},
+	common.RequestType_SHORTS:          {"shorts", "short films"},
+}
+
+// sectionTypes are the Plex and Jellyfin/Emby section types that can hold a category
+var sectionTypes = map[common.RequestType][]string{
+	common.RequestType_FILMS:           {"movie", "movies"},
+	common.RequestType_SERIES:          {"show", "tvshows"},
+	common.RequestType_CARTOONS:        {"movie", "movies"},
+	common.RequestType_CARTOONS_SERIES: {"show", "tvshows"},
+	common.RequestType_SHORTS:          {"movie", "movies"},
+}
+
+// Section is a library section of a media server
+type Section struct {
+	Key       string
+	Title     string
+	Type      string
+	Locations []string
+}
+
+type sectionsResponse struct {
+	MediaContainer struct {
+		Directory []struct {
+			Key      string `json:"key"`
+			Title    string `json:"title"`
+			Type     string `json:"type"`
+			Location []struct {
+				Path string `json:"path"`
+			} `json:"Location"`
+		} `json:"Directory"`
+	} `json:"MediaContainer"`
+}
+
+// Sections lists the library sections of the Plex server
+func (c *Client) Sections(ctx context.Context) ([]Section, error) {
+	var resp sectionsResponse
+	if err := c.getJSON(ctx, "/library/sections", &resp); err != nil {
+		return nil, err
+	}
+
+	sections := make([]Section, 0, len(resp.MediaContainer.Directory))
+	for _, d := range resp.MediaContainer.Directory {
+		section := Section{Key: d.Key, Title: d.Title, Type: d.Type}
+		for _, l := range d.Location {
+			section.Locations = append(section.Locations, l.Path)
+		}
+		sections = append(sections, section)
+	}
+
+	return sections, nil
+}
+
+// DiscoverSections maps each category to a library section and uses the mapping for scans
+func (c *Client) DiscoverSections(ctx context.Context, configured map[common.RequestType]string, downloadPaths map[common.RequestType]string) error {
+	sections, err := c.Sections(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list Plex library sections: %w", err)
+	}
+
+	pbTypeToCategoryId, err := mapSections(sections, configured, downloadPaths, c.pathMapping)
+	if err != nil {
+		return err
+	}
+
+	c.pbTypeToCategoryId = pbTypeToCategoryId
+	return nil
+}
+
+// mapSections maps each category to a library section. A configured value is a section ID or title;
+// otherwise the section of the category's type with the deepest location at or inside the category
+// download path is used, then the section of that type with a conventional title (e.g. "Movies"). It fails with a report of the available
+// sections if a category has no matching section.
+func mapSections(sections []Section, configured map[common.RequestType]string, downloadPaths map[common.RequestType]string, pathMapping paths.Mapping) (map[common.RequestType]string, error) {
+	categories := make([]common.RequestType, 0, len(defaultSectionNames))
+	for category := range defaultSectionNames {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i] < categories[j] })
+
+	pbTypeToCategoryId := make(map[common.RequestType]string, len(categories))
+	var missing []string
+
+	for _, category := range categories {
+		section, how := matchSection(sections, category, configured[category], pathMapping.Apply(downloadPaths[category]))
+		if section == nil {
+			missing = append(missing, category.String())
+			continue
+		}
+
+		log.Printf("Library section for %s: %s (id: %s, matched by %s)", category, section.Title, section.Key, how)
+		pbTypeToCategoryId[category] = section.Key
+	}
+
+	if len(missing) > 0 {
+		available := make([]string, 0, len(sections))
+		for _, s := range sections {
+			available = append(available, fmt.Sprintf("%s (id: %s, locations: %s)", s.Title, s.Key, strings.Join(s.Locations, ", ")))
+		}
+		return nil, fmt.Errorf("no library section found for %s; set PLEX_CATEGORY_<NAME> to a section ID or title, available sections: %s",
+			strings.Join(missing, ", "), strings.Join(available, "; "))
+	}
+
+	return pbTypeToCategoryId, nil
+}
+
+func matchSection(sections []Section, category common.RequestType, configured string, downloadPath string) (*Section, string) {
+	if configured != "" {
+		for i, s := range sections {
+			if s.Key == configured || strings.EqualFold(s.Title, configured) {
+				return &sections[i], "configuration"
+			}
+		}
+		return nil, ""
+	}
+
+	// A parent location, e.g. /data, would capture every category, only locations within the download path count
+	if downloadPath != "" {
+		var match *Section
+		matchLength := 0
+		for i, s := range sections {
+			if !hasSectionType(s, category) {
+				continue
+			}
+			for _, location := range s.Locations {
+				if isSameOrInside(location, downloadPath) && len(filepath.Clean(location)) > matchLength {
+					match, matchLength = &sections[i], len(filepath.Clean(location))
+				}
+			}
+		}
+		if match != nil {
+			return match, "location"
+		}
+	}
+
+	for _, name := range defaultSectionNames[category] {
+		for i, s := range sections {
+			if hasSectionType(s, category) && strings.EqualFold(s.Title, name) {
+				return &sections[i], "title"
+			}
+		}
+	}
+
+	return nil, ""
+}
+
+// hasSectionType reports whether a section can hold a category, sections of unknown type can hold any
+func hasSectionType(s Section, category common.RequestType) bool {
+	return s.Type == "" || slices.Contains(sectionTypes[category], strings.ToLower(s.Type))
+}
+
+// isSameOrInside reports whether path is dir or a path inside it
+func isSameOrInside(path string, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
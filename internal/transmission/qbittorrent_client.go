@@ -0,0 +1,197 @@
+package transmission
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	// errNotFound is returned for qBittorrent API endpoints missing in the running version
+	errNotFound = errors.New("endpoint not found")
+	// errForbidden is returned when the session cookie is missing or expired
+	errForbidden = errors.New("forbidden")
+)
+
+// QBittorrentClient is a qBittorrent Web API client
+type QBittorrentClient struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+	loginMu    sync.Mutex
+}
+
+// NewQBittorrentClient creates a new qBittorrent Web API client
+func NewQBittorrentClient(baseURL string, username string, password string) (*QBittorrentClient, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie jar: %w", err)
+	}
+
+	return &QBittorrentClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Jar: jar},
+	}, nil
+}
+
+// qbTorrent is a torrent as returned by /api/v2/torrents/info
+type qbTorrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	State       string  `json:"state"`
+	Progress    float64 `json:"progress"`
+	TotalSize   int64   `json:"total_size"`
+	Completed   int64   `json:"completed"`
+	Uploaded    int64   `json:"uploaded"`
+	DlSpeed     int64   `json:"dlspeed"`
+	UpSpeed     int64   `json:"upspeed"`
+	NumSeeds    int64   `json:"num_seeds"`
+	NumLeechs   int64   `json:"num_leechs"`
+	Tracker     string  `json:"tracker"`
+	Eta         int64   `json:"eta"`
+	Ratio       float64 `json:"ratio"`
+	SeedingTime int64   `json:"seeding_time"`
+	SavePath    string  `json:"save_path"`
+	Tags        string  `json:"tags"`
+}
+
+// qbFile is a torrent file as returned by /api/v2/torrents/files
+type qbFile struct {
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+}
+
+// Login authenticates the client, the session cookie is kept for later requests.
+// Without a username it relies on qBittorrent's authentication bypass for trusted subnets.
+func (c *QBittorrentClient) Login(ctx context.Context) error {
+	if c.username == "" {
+		return nil
+	}
+
+	c.loginMu.Lock()
+	defer c.loginMu.Unlock()
+
+	form := url.Values{"username": {c.username}, "password": {c.password}}
+	body, err := c.request(ctx, "/api/v2/auth/login", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(string(body)) != "Ok." {
+		return errors.New("qBittorrent rejected the credentials, check QBITTORRENT_USER and QBITTORRENT_PASSWORD")
+	}
+
+	return nil
+}
+
+// PostForm calls a Web API method with form values and returns the response body
+func (c *QBittorrentClient) PostForm(ctx context.Context, method string, form url.Values) ([]byte, error) {
+	return c.call(ctx, method, func() (string, io.Reader, error) {
+		return "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), nil
+	})
+}
+
+// PostMultipart calls a Web API method with multipart fields and files and returns the response body
+func (c *QBittorrentClient) PostMultipart(ctx context.Context, method string, fields map[string]string, files map[string][]byte) ([]byte, error) {
+	return c.call(ctx, method, func() (string, io.Reader, error) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		for name, value := range fields {
+			if err := w.WriteField(name, value); err != nil {
+				return "", nil, err
+			}
+		}
+		for name, data := range files {
+			part, err := w.CreateFormFile(name, name+".torrent")
+			if err != nil {
+				return "", nil, err
+			}
+			if _, err := part.Write(data); err != nil {
+				return "", nil, err
+			}
+		}
+		if err := w.Close(); err != nil {
+			return "", nil, err
+		}
+		return w.FormDataContentType(), &buf, nil
+	})
+}
+
+// GetJSON calls a Web API method and decodes its JSON response
+func (c *QBittorrentClient) GetJSON(ctx context.Context, method string, form url.Values, v any) error {
+	body, err := c.PostForm(ctx, method, form)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+
+	return nil
+}
+
+// call sends a request, logging in again once if the session expired
+func (c *QBittorrentClient) call(ctx context.Context, method string, body func() (string, io.Reader, error)) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		contentType, reader, err := body()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build request: %w", err)
+		}
+
+		resp, err := c.request(ctx, method, contentType, reader)
+		if errors.Is(err, errForbidden) && attempt == 0 {
+			if err := c.Login(ctx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return resp, err
+	}
+}
+
+func (c *QBittorrentClient) request(ctx context.Context, method string, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+method, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	// qBittorrent's CSRF protection requires a matching Referer
+	req.Header.Set("Referer", c.baseURL)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusForbidden:
+		return nil, errForbidden
+	case http.StatusNotFound:
+		return nil, errNotFound
+	default:
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+}
@@ -0,0 +1,564 @@
+package transmission
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	transmissionpb "github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// qbInfiniteEta is the ETA qBittorrent reports when it is unknown
+	qbInfiniteEta = 8640000
+	// qbAddAttempts and qbAddInterval bound the wait for an added torrent to show up
+	qbAddAttempts = 20
+	qbAddInterval = 500 * time.Millisecond
+)
+
+// QBittorrentServer implements the TransmissionService contract on top of qBittorrent.
+// Torrents are identified by hash in qBittorrent, their IDs are derived from the hash.
+type QBittorrentServer struct {
+	transmissionpb.UnimplementedTransmissionServiceServer
+	client *QBittorrentClient
+}
+
+func NewQBittorrentServer(client *QBittorrentClient) *QBittorrentServer {
+	return &QBittorrentServer{
+		client: client,
+	}
+}
+
+func (s *QBittorrentServer) AddTorrentByMagnet(ctx context.Context, req *transmissionpb.AddTorrentByMagnetRequest) (*transmissionpb.AddTorrentResponse, error) {
+	fields := addFields(req.Filedir, req.Category, req.RequestId, req.Paused)
+	fields["urls"] = req.MagnetLink
+
+	return s.addTorrent(ctx, req.RequestId, fields, nil)
+}
+
+func (s *QBittorrentServer) AddTorrentByFile(ctx context.Context, req *transmissionpb.AddTorrentByFileRequest) (*transmissionpb.AddTorrentResponse, error) {
+	data, err := base64.StdEncoding.DecodeString(req.Base64File)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid torrent file: %v", err)
+	}
+
+	fields := addFields(req.Filedir, req.Category, req.RequestId, req.Paused)
+	return s.addTorrent(ctx, req.RequestId, fields, map[string][]byte{"torrents": data})
+}
+
+func addFields(saveDir string, category string, requestID string, paused bool) map[string]string {
+	tags := []string{requestLabelPrefix + requestID}
+	if category != "" {
+		tags = append(tags, category)
+	}
+
+	fields := map[string]string{
+		"savepath": saveDir,
+		"tags":     strings.Join(tags, ","),
+	}
+	if paused {
+		// qBittorrent 5 renamed "paused" to "stopped"
+		fields["paused"] = "true"
+		fields["stopped"] = "true"
+	}
+	return fields
+}
+
+func (s *QBittorrentServer) addTorrent(ctx context.Context, requestID string, fields map[string]string, files map[string][]byte) (*transmissionpb.AddTorrentResponse, error) {
+	body, err := s.client.PostMultipart(ctx, "/api/v2/torrents/add", fields, files)
+	if err != nil {
+		log.Printf("failed to add torrent (requestID: %s): %v", requestID, err)
+		return nil, status.Errorf(codes.Internal, "failed to add torrent: %v", err)
+	}
+
+	if strings.TrimSpace(string(body)) != "Ok." {
+		log.Printf("torrent rejected (requestID: %s): %s", requestID, body)
+		return nil, status.Errorf(codes.InvalidArgument, "qBittorrent rejected the torrent: %s", body)
+	}
+
+	// Adding is asynchronous, wait for the torrent to show up under its request tag
+	for attempt := 0; attempt < qbAddAttempts; attempt++ {
+		var torrents []qbTorrent
+		err := s.client.GetJSON(ctx, "/api/v2/torrents/info", url.Values{"tag": {requestLabelPrefix + requestID}}, &torrents)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to find added torrent: %v", err)
+		}
+
+		if len(torrents) > 0 {
+			t := torrents[0]
+			id, err := qbTorrentID(t.Hash)
+			if err != nil {
+				log.Printf("added torrent has an invalid hash (requestID: %s): %v", requestID, err)
+				return nil, status.Errorf(codes.Internal, "added torrent has an invalid hash: %v", err)
+			}
+
+			log.Printf("torrent added (requestID: %s): hash: %s, name: %s", requestID, t.Hash, t.Name)
+			return &transmissionpb.AddTorrentResponse{
+				TorrentId: id,
+				Name:      t.Name,
+			}, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-time.After(qbAddInterval):
+		}
+	}
+
+	return nil, status.Error(codes.Internal, "added torrent did not show up in qBittorrent")
+}
+
+func (s *QBittorrentServer) GetTorrentStatus(ctx context.Context, req *transmissionpb.GetTorrentStatusRequest) (*transmissionpb.GetTorrentStatusResponse, error) {
+	t, err := s.findTorrent(ctx, req.TorrentId)
+	if err != nil {
+		log.Printf("failed to get torrent status (requestID: %s): %v", req.RequestId, err)
+		return nil, err
+	}
+
+	return qbStatusResponse(req.TorrentId, t), nil
+}
+
+func (s *QBittorrentServer) GetTorrentsStatus(ctx context.Context, req *transmissionpb.GetTorrentsStatusRequest) (*transmissionpb.GetTorrentsStatusResponse, error) {
+	var torrents []qbTorrent
+	if err := s.client.GetJSON(ctx, "/api/v2/torrents/info", nil, &torrents); err != nil {
+		log.Printf("failed to get torrents status: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to list torrents: %v", err)
+	}
+
+	statuses := make([]*transmissionpb.GetTorrentStatusResponse, 0, len(req.TorrentIds)+len(req.Hashes))
+	for i := range torrents {
+		t := &torrents[i]
+		id, err := qbTorrentID(t.Hash)
+		if err != nil {
+			log.Printf("skipping torrent with an invalid hash: %v", err)
+			continue
+		}
+
+		if slices.Contains(req.TorrentIds, id) || slices.ContainsFunc(req.Hashes, func(hash string) bool { return strings.EqualFold(hash, t.Hash) }) {
+			statuses = append(statuses, qbStatusResponse(id, t))
+		}
+	}
+
+	return &transmissionpb.GetTorrentsStatusResponse{Torrents: statuses}, nil
+}
+
+func qbStatusResponse(id int64, t *qbTorrent) *transmissionpb.GetTorrentStatusResponse {
+	eta := t.Eta
+	if eta >= qbInfiniteEta {
+		eta = -1
+	}
+
+	return &transmissionpb.GetTorrentStatusResponse{
+		TorrentId:          id,
+		Name:               t.Name,
+		Progress:           t.Progress * 100,
+		SizeBytes:          t.TotalSize,
+		DownloadedBytes:    t.Completed,
+		UploadedBytes:      t.Uploaded,
+		Status:             qbStatus(t.State),
+		State:              qbState(t.State),
+		DownloadRate:       int32(t.DlSpeed),
+		Eta:                int32(eta),
+		UploadRatio:        t.Ratio,
+		SecondsSeeding:     t.SeedingTime,
+		Hash:               t.Hash,
+		UploadRate:         int32(t.UpSpeed),
+		PeersConnected:     int32(t.NumSeeds + t.NumLeechs),
+		PeersSendingToUs:   int32(t.NumSeeds),
+		PeersGettingFromUs: int32(t.NumLeechs),
+		TrackerStatus:      qbTrackerStatus(t.Tracker),
+		ErrorString:        qbErrorString(t.State),
+	}
+}
+
+// qbTrackerStatus reports the tracker qBittorrent currently announces to, if any. The torrent list
+// doesn't carry the announce result, so its status is unknown.
+func qbTrackerStatus(tracker string) string {
+	if tracker == "" {
+		return "no working tracker"
+	}
+	if u, err := url.Parse(tracker); err == nil && u.Host != "" {
+		return u.Host + ": status unknown"
+	}
+	return tracker + ": status unknown"
+}
+
+// qbErrorString explains error states, qBittorrent doesn't report the error text in the torrent list
+func qbErrorString(state string) string {
+	switch state {
+	case "error":
+		return "qBittorrent reported an I/O error, check the torrent in qBittorrent"
+	case "missingFiles":
+		return "files are missing from the download directory"
+	default:
+		return ""
+	}
+}
+
+// qbStatus maps a qBittorrent torrent state to a TorrentStatus
+func qbStatus(state string) transmissionpb.TorrentStatus {
+	switch state {
+	case "error", "missingFiles":
+		return transmissionpb.TorrentStatus_STATUS_ERROR
+	case "pausedDL", "stoppedDL", "pausedUP", "stoppedUP":
+		return transmissionpb.TorrentStatus_STATUS_STOPPED
+	case "uploading", "stalledUP", "queuedUP", "forcedUP", "checkingUP":
+		return transmissionpb.TorrentStatus_STATUS_DONE
+	case "downloading", "stalledDL", "metaDL", "forcedMetaDL", "queuedDL", "forcedDL", "checkingDL", "allocating", "checkingResumeData", "moving":
+		return transmissionpb.TorrentStatus_STATUS_IN_PROGRESS
+	default:
+		return transmissionpb.TorrentStatus_STATUS_UNSPECIFIED
+	}
+}
+
+func (s *QBittorrentServer) ListTorrents(ctx context.Context, req *transmissionpb.ListTorrentsRequest) (*transmissionpb.ListTorrentsResponse, error) {
+	var torrents []qbTorrent
+	if err := s.client.GetJSON(ctx, "/api/v2/torrents/info", nil, &torrents); err != nil {
+		log.Printf("failed to list torrents: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to list torrents: %v", err)
+	}
+
+	summaries := make([]*transmissionpb.TorrentSummary, 0, len(torrents))
+	for _, t := range torrents {
+		id, err := qbTorrentID(t.Hash)
+		if err != nil {
+			log.Printf("skipping torrent with an invalid hash: %v", err)
+			continue
+		}
+
+		var labels []string
+		for _, tag := range strings.Split(t.Tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				labels = append(labels, tag)
+			}
+		}
+
+		summary := &transmissionpb.TorrentSummary{
+			TorrentId:   id,
+			Name:        t.Name,
+			Status:      qbStatus(t.State),
+			State:       qbState(t.State),
+			Progress:    t.Progress * 100,
+			SizeBytes:   t.TotalSize,
+			Labels:      labels,
+			DownloadDir: t.SavePath,
+		}
+
+		if matchesListFilter(summary, req) {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].TorrentId < summaries[j].TorrentId })
+	return &transmissionpb.ListTorrentsResponse{Torrents: summaries}, nil
+}
+
+// qbState maps a qBittorrent torrent state to a detailed TorrentState
+func qbState(state string) transmissionpb.TorrentState {
+	switch state {
+	case "error", "missingFiles":
+		return transmissionpb.TorrentState_STATE_ERROR
+	case "pausedUP", "stoppedUP":
+		return transmissionpb.TorrentState_STATE_FINISHED
+	case "pausedDL", "stoppedDL":
+		return transmissionpb.TorrentState_STATE_PAUSED
+	case "checkingDL", "checkingUP", "checkingResumeData":
+		return transmissionpb.TorrentState_STATE_VERIFYING
+	case "queuedDL":
+		return transmissionpb.TorrentState_STATE_QUEUED
+	case "metaDL", "forcedMetaDL":
+		return transmissionpb.TorrentState_STATE_METADATA
+	case "uploading", "stalledUP", "queuedUP", "forcedUP":
+		return transmissionpb.TorrentState_STATE_SEEDING
+	case "downloading", "stalledDL", "forcedDL", "allocating", "moving":
+		return transmissionpb.TorrentState_STATE_DOWNLOADING
+	default:
+		return transmissionpb.TorrentState_STATE_UNSPECIFIED
+	}
+}
+
+func (s *QBittorrentServer) GetTorrentFiles(ctx context.Context, req *transmissionpb.GetTorrentFilesRequest) (*transmissionpb.GetTorrentFilesResponse, error) {
+	t, err := s.findTorrent(ctx, req.TorrentId)
+	if err != nil {
+		return nil, err
+	}
+
+	var qbFiles []qbFile
+	if err := s.client.GetJSON(ctx, "/api/v2/torrents/files", url.Values{"hash": {t.Hash}}, &qbFiles); err != nil {
+		log.Printf("failed to get torrent files (hash: %s): %v", t.Hash, err)
+		return nil, status.Errorf(codes.Internal, "failed to get torrent files: %v", err)
+	}
+
+	files := make([]*transmissionpb.TorrentFile, 0, len(qbFiles))
+	for _, f := range qbFiles {
+		files = append(files, &transmissionpb.TorrentFile{
+			Name:           f.Name,
+			SizeBytes:      f.Size,
+			CompletedBytes: int64(f.Progress * float64(f.Size)),
+		})
+	}
+
+	return &transmissionpb.GetTorrentFilesResponse{
+		DownloadDir: t.SavePath,
+		Files:       files,
+	}, nil
+}
+
+func (s *QBittorrentServer) StartTorrents(ctx context.Context, req *transmissionpb.StartTorrentsRequest) (*transmissionpb.StartTorrentsResponse, error) {
+	// qBittorrent 5 renamed "resume" to "start"
+	if err := s.torrentsAction(ctx, req.TorrentIds, "/api/v2/torrents/start", "/api/v2/torrents/resume", nil); err != nil {
+		log.Printf("failed to start torrents (ids: %v): %v", req.TorrentIds, err)
+		return nil, err
+	}
+
+	log.Printf("torrents started: %v", req.TorrentIds)
+	return &transmissionpb.StartTorrentsResponse{}, nil
+}
+
+func (s *QBittorrentServer) StopTorrents(ctx context.Context, req *transmissionpb.StopTorrentsRequest) (*transmissionpb.StopTorrentsResponse, error) {
+	// qBittorrent 5 renamed "pause" to "stop"
+	if err := s.torrentsAction(ctx, req.TorrentIds, "/api/v2/torrents/stop", "/api/v2/torrents/pause", nil); err != nil {
+		log.Printf("failed to stop torrents (ids: %v): %v", req.TorrentIds, err)
+		return nil, err
+	}
+
+	log.Printf("torrents stopped: %v", req.TorrentIds)
+	return &transmissionpb.StopTorrentsResponse{}, nil
+}
+
+func (s *QBittorrentServer) SetSeedLimits(ctx context.Context, req *transmissionpb.SetSeedLimitsRequest) (*transmissionpb.SetSeedLimitsResponse, error) {
+	// -2 keeps the global setting
+	ratio := "-2"
+	if req.RatioLimit > 0 {
+		ratio = strconv.FormatFloat(req.RatioLimit, 'f', 2, 64)
+	}
+
+	form := url.Values{
+		"ratioLimit":               {ratio},
+		"seedingTimeLimit":         {"-2"},
+		"inactiveSeedingTimeLimit": {"-2"},
+	}
+	if err := s.torrentsAction(ctx, []int64{req.TorrentId}, "/api/v2/torrents/setShareLimits", "", form); err != nil {
+		log.Printf("failed to set seed limits (id: %d): %v", req.TorrentId, err)
+		return nil, err
+	}
+
+	log.Printf("seed limits set (id: %d): ratio: %.2f", req.TorrentId, req.RatioLimit)
+	return &transmissionpb.SetSeedLimitsResponse{}, nil
+}
+
+func (s *QBittorrentServer) RemoveTorrent(ctx context.Context, req *transmissionpb.RemoveTorrentRequest) (*transmissionpb.RemoveTorrentResponse, error) {
+	form := url.Values{"deleteFiles": {strconv.FormatBool(req.DeleteLocalData)}}
+	if err := s.torrentsAction(ctx, []int64{req.TorrentId}, "/api/v2/torrents/delete", "", form); err != nil {
+		log.Printf("failed to remove torrent (id: %d): %v", req.TorrentId, err)
+		return nil, err
+	}
+
+	log.Printf("torrent removed (id: %d, deleteLocalData: %t)", req.TorrentId, req.DeleteLocalData)
+	return &transmissionpb.RemoveTorrentResponse{}, nil
+}
+
+// GetFreeSpace reports the free space of qBittorrent's default save path disk, whatever the path
+func (s *QBittorrentServer) GetFreeSpace(ctx context.Context, req *transmissionpb.GetFreeSpaceRequest) (*transmissionpb.GetFreeSpaceResponse, error) {
+	var data struct {
+		ServerState struct {
+			FreeSpaceOnDisk int64 `json:"free_space_on_disk"`
+		} `json:"server_state"`
+	}
+	if err := s.client.GetJSON(ctx, "/api/v2/sync/maindata", nil, &data); err != nil {
+		log.Printf("failed to get free space (path: %s): %v", req.Path, err)
+		return nil, status.Errorf(codes.Internal, "failed to get free space: %v", err)
+	}
+
+	return &transmissionpb.GetFreeSpaceResponse{
+		Path:      req.Path,
+		FreeBytes: data.ServerState.FreeSpaceOnDisk,
+	}, nil
+}
+
+func (s *QBittorrentServer) GetSession(ctx context.Context, req *transmissionpb.GetSessionRequest) (*transmissionpb.SessionSettings, error) {
+	return s.getSessionSettings(ctx)
+}
+
+func (s *QBittorrentServer) SetSession(ctx context.Context, req *transmissionpb.SetSessionRequest) (*transmissionpb.SessionSettings, error) {
+	// Limits are in KB/s in the contract and in bytes/s in qBittorrent, 0 means unlimited
+	prefs := make(map[string]int64)
+	setLimit := func(key string, enabled *bool, limit *int64) {
+		switch {
+		case enabled != nil && !*enabled:
+			prefs[key] = 0
+		case limit != nil:
+			prefs[key] = *limit * 1024
+		}
+	}
+	setLimit("dl_limit", req.SpeedLimitDownEnabled, req.SpeedLimitDown)
+	setLimit("up_limit", req.SpeedLimitUpEnabled, req.SpeedLimitUp)
+	setLimit("alt_dl_limit", nil, req.AltSpeedDown)
+	setLimit("alt_up_limit", nil, req.AltSpeedUp)
+
+	if len(prefs) > 0 {
+		data, err := json.Marshal(prefs)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode preferences: %v", err)
+		}
+		if _, err := s.client.PostForm(ctx, "/api/v2/app/setPreferences", url.Values{"json": {string(data)}}); err != nil {
+			log.Printf("failed to set preferences: %v", err)
+			return nil, status.Errorf(codes.Internal, "failed to set session: %v", err)
+		}
+	}
+
+	if req.AltSpeedEnabled != nil {
+		enabled, err := s.altSpeedEnabled(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if enabled != *req.AltSpeedEnabled {
+			if _, err := s.client.PostForm(ctx, "/api/v2/transfer/toggleSpeedLimitsMode", nil); err != nil {
+				log.Printf("failed to toggle alternative speed limits: %v", err)
+				return nil, status.Errorf(codes.Internal, "failed to set session: %v", err)
+			}
+		}
+	}
+
+	return s.getSessionSettings(ctx)
+}
+
+func (s *QBittorrentServer) getSessionSettings(ctx context.Context) (*transmissionpb.SessionSettings, error) {
+	var prefs struct {
+		DlLimit    int64 `json:"dl_limit"`
+		UpLimit    int64 `json:"up_limit"`
+		AltDlLimit int64 `json:"alt_dl_limit"`
+		AltUpLimit int64 `json:"alt_up_limit"`
+	}
+	if err := s.client.GetJSON(ctx, "/api/v2/app/preferences", nil, &prefs); err != nil {
+		log.Printf("failed to get preferences: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get session: %v", err)
+	}
+
+	var info struct {
+		DlInfoSpeed int64 `json:"dl_info_speed"`
+		UpInfoSpeed int64 `json:"up_info_speed"`
+	}
+	if err := s.client.GetJSON(ctx, "/api/v2/transfer/info", nil, &info); err != nil {
+		log.Printf("failed to get transfer info: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get session stats: %v", err)
+	}
+
+	altSpeedEnabled, err := s.altSpeedEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &transmissionpb.SessionSettings{
+		AltSpeedEnabled:       altSpeedEnabled,
+		SpeedLimitDownEnabled: prefs.DlLimit > 0,
+		SpeedLimitDown:        prefs.DlLimit / 1024,
+		SpeedLimitUpEnabled:   prefs.UpLimit > 0,
+		SpeedLimitUp:          prefs.UpLimit / 1024,
+		AltSpeedDown:          prefs.AltDlLimit / 1024,
+		AltSpeedUp:            prefs.AltUpLimit / 1024,
+		DownloadRate:          info.DlInfoSpeed,
+		UploadRate:            info.UpInfoSpeed,
+	}, nil
+}
+
+func (s *QBittorrentServer) altSpeedEnabled(ctx context.Context) (bool, error) {
+	body, err := s.client.PostForm(ctx, "/api/v2/transfer/speedLimitsMode", nil)
+	if err != nil {
+		log.Printf("failed to get speed limits mode: %v", err)
+		return false, status.Errorf(codes.Internal, "failed to get session: %v", err)
+	}
+	return strings.TrimSpace(string(body)) == "1", nil
+}
+
+// torrentsAction calls a method taking a list of hashes, falling back to the pre-v5 method name if set
+func (s *QBittorrentServer) torrentsAction(ctx context.Context, ids []int64, method string, fallback string, form url.Values) error {
+	torrents, err := s.torrentsByID(ctx)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		t, ok := torrents[id]
+		if !ok {
+			return status.Errorf(codes.NotFound, "torrent not found (id: %d)", id)
+		}
+		hashes = append(hashes, t.Hash)
+	}
+
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("hashes", strings.Join(hashes, "|"))
+
+	_, err = s.client.PostForm(ctx, method, form)
+	if errors.Is(err, errNotFound) && fallback != "" {
+		_, err = s.client.PostForm(ctx, fallback, form)
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to call %s: %v", method, err)
+	}
+
+	return nil
+}
+
+// findTorrent returns the torrent whose hash-derived ID matches
+func (s *QBittorrentServer) findTorrent(ctx context.Context, id int64) (*qbTorrent, error) {
+	torrents, err := s.torrentsByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := torrents[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "torrent not found")
+	}
+	return t, nil
+}
+
+// torrentsByID lists the torrents once and indexes them by their hash-derived ID, torrents with an
+// invalid hash are left out
+func (s *QBittorrentServer) torrentsByID(ctx context.Context) (map[int64]*qbTorrent, error) {
+	var torrents []qbTorrent
+	if err := s.client.GetJSON(ctx, "/api/v2/torrents/info", nil, &torrents); err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to list torrents: %v", err)
+	}
+
+	byID := make(map[int64]*qbTorrent, len(torrents))
+	for i := range torrents {
+		id, err := qbTorrentID(torrents[i].Hash)
+		if err != nil {
+			log.Printf("skipping torrent with an invalid hash: %v", err)
+			continue
+		}
+		byID[id] = &torrents[i]
+	}
+
+	return byID, nil
+}
+
+// qbTorrentID derives a stable positive ID from the first 60 bits of a torrent hash
+func qbTorrentID(hash string) (int64, error) {
+	prefix := hash
+	if len(prefix) > 15 {
+		prefix = prefix[:15]
+	}
+	id, err := strconv.ParseInt(prefix, 16, 64)
+	if err != nil || id < 0 {
+		return 0, fmt.Errorf("invalid torrent hash %q", hash)
+	}
+	return id, nil
+}
@@ -0,0 +1,111 @@
+package transmission
+
+import (
+	"encoding/json"
+	"testing"
+
+	transmissionpb "github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
+)
+
+// torrentsInfo is a trimmed /api/v2/torrents/info response
+const torrentsInfo = `[
+	{"hash": "8c4adbf9ebe66f1d804fb6a4fb9b74966c3ab609", "name": "Movie.2019.1080p", "state": "stalledDL",
+	 "progress": 0.25, "total_size": 4000, "completed": 1000, "dlspeed": 0, "num_seeds": 0, "num_leechs": 2,
+	 "tracker": "udp://tracker.example.org:1337/announce", "eta": 8640000, "ratio": 0.1},
+	{"hash": "f1d2d2f924e986ac86fdf7b36c94bcdf32beec15", "name": "Show.S01E01", "state": "pausedUP",
+	 "progress": 1, "total_size": 2000, "completed": 2000, "uploaded": 4000, "ratio": 2, "seeding_time": 3600,
+	 "tracker": ""},
+	{"hash": "00aa", "name": "Broken", "state": "missingFiles"}
+]`
+
+func TestQbStatusResponse(t *testing.T) {
+	var torrents []qbTorrent
+	if err := json.Unmarshal([]byte(torrentsInfo), &torrents); err != nil {
+		t.Fatal(err)
+	}
+
+	stalled := qbStatusResponse(1, &torrents[0])
+	if stalled.Status != transmissionpb.TorrentStatus_STATUS_IN_PROGRESS || stalled.State != transmissionpb.TorrentState_STATE_DOWNLOADING {
+		t.Errorf("stalled download = %s/%s, want in progress/downloading", stalled.Status, stalled.State)
+	}
+	if stalled.Progress != 25 {
+		t.Errorf("progress = %v, qBittorrent reports a fraction, want 25", stalled.Progress)
+	}
+	if stalled.Eta != -1 {
+		t.Errorf("eta = %d, qBittorrent's infinite ETA should be unknown", stalled.Eta)
+	}
+	if stalled.PeersConnected != 2 || stalled.PeersSendingToUs != 0 || stalled.PeersGettingFromUs != 2 {
+		t.Errorf("peers = %d (%d sending, %d getting)", stalled.PeersConnected, stalled.PeersSendingToUs, stalled.PeersGettingFromUs)
+	}
+	if stalled.TrackerStatus != "tracker.example.org:1337: status unknown" {
+		t.Errorf("tracker status = %q", stalled.TrackerStatus)
+	}
+
+	// Paused after completing, e.g. by its share limit, the coordinator counts it as complete
+	finished := qbStatusResponse(2, &torrents[1])
+	if finished.Status != transmissionpb.TorrentStatus_STATUS_STOPPED || finished.State != transmissionpb.TorrentState_STATE_FINISHED {
+		t.Errorf("finished torrent = %s/%s, want stopped/finished", finished.Status, finished.State)
+	}
+	if finished.UploadRatio != 2 || finished.SecondsSeeding != 3600 || finished.TrackerStatus != "no working tracker" {
+		t.Errorf("finished torrent = ratio %v, seeding %ds, tracker %q", finished.UploadRatio, finished.SecondsSeeding, finished.TrackerStatus)
+	}
+
+	broken := qbStatusResponse(3, &torrents[2])
+	if broken.Status != transmissionpb.TorrentStatus_STATUS_ERROR || broken.ErrorString == "" {
+		t.Errorf("missing files = %s with error %q, want an error with its explanation", broken.Status, broken.ErrorString)
+	}
+}
+
+// Every qBittorrent state maps to a status and a detailed state that agree with each other
+func TestQbStatesAgree(t *testing.T) {
+	states := map[transmissionpb.TorrentStatus][]transmissionpb.TorrentState{
+		transmissionpb.TorrentStatus_STATUS_IN_PROGRESS: {
+			transmissionpb.TorrentState_STATE_DOWNLOADING, transmissionpb.TorrentState_STATE_QUEUED,
+			transmissionpb.TorrentState_STATE_METADATA, transmissionpb.TorrentState_STATE_VERIFYING,
+		},
+		transmissionpb.TorrentStatus_STATUS_DONE:    {transmissionpb.TorrentState_STATE_SEEDING, transmissionpb.TorrentState_STATE_VERIFYING},
+		transmissionpb.TorrentStatus_STATUS_STOPPED: {transmissionpb.TorrentState_STATE_PAUSED, transmissionpb.TorrentState_STATE_FINISHED},
+		transmissionpb.TorrentStatus_STATUS_ERROR:   {transmissionpb.TorrentState_STATE_ERROR},
+	}
+
+	for _, state := range []string{
+		"error", "missingFiles", "uploading", "pausedUP", "stoppedUP", "queuedUP", "stalledUP", "checkingUP", "forcedUP",
+		"allocating", "downloading", "metaDL", "forcedMetaDL", "pausedDL", "stoppedDL", "queuedDL", "stalledDL",
+		"checkingDL", "forcedDL", "checkingResumeData", "moving",
+	} {
+		torrentStatus, detail := qbStatus(state), qbState(state)
+		allowed, ok := states[torrentStatus]
+		if !ok {
+			t.Errorf("%s has no status", state)
+			continue
+		}
+		found := false
+		for _, s := range allowed {
+			found = found || s == detail
+		}
+		if !found {
+			t.Errorf("%s = %s with state %s, they disagree", state, torrentStatus, detail)
+		}
+	}
+
+	if qbStatus("unknown") != transmissionpb.TorrentStatus_STATUS_UNSPECIFIED || qbState("unknown") != transmissionpb.TorrentState_STATE_UNSPECIFIED {
+		t.Error("an unknown state should be unspecified")
+	}
+}
+
+func TestQbTorrentID(t *testing.T) {
+	hash := "8c4adbf9ebe66f1d804fb6a4fb9b74966c3ab609"
+	id, err := qbTorrentID(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := qbTorrentID(hash); again != id || id <= 0 {
+		t.Errorf("qbTorrentID(%q) = %d then %d, want the same positive ID", hash, id, again)
+	}
+
+	for _, invalid := range []string{"", "not a hash", "zz4adbf9ebe66f1"} {
+		if _, err := qbTorrentID(invalid); err == nil {
+			t.Errorf("qbTorrentID(%q) should fail", invalid)
+		}
+	}
+}
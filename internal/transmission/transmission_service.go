@@ -2,7 +2,10 @@ package transmission
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"slices"
+	"sort"
 
 	transmissionpb "github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
 	transmissionrpc "github.com/hekmon/transmissionrpc/v3"
@@ -10,6 +13,10 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// requestLabelPrefix labels torrents with their request ID, so they can be found after adding
+// and matched with their request if the coordinator loses its records
+const requestLabelPrefix = "mdb-"
+
 type Server struct {
 	transmissionpb.UnimplementedTransmissionServiceServer
 	client *transmissionrpc.Client
@@ -22,12 +29,11 @@ func NewServer(client *transmissionrpc.Client) *Server {
 }
 
 func (s *Server) AddTorrentByMagnet(ctx context.Context, req *transmissionpb.AddTorrentByMagnetRequest) (*transmissionpb.AddTorrentResponse, error) {
-	paused := false
 	payload := &transmissionrpc.TorrentAddPayload{
 		Filename:    &req.MagnetLink,
 		DownloadDir: &req.Filedir,
-		Paused:      &paused,
-		Labels:      []string{req.Category},
+		Paused:      &req.Paused,
+		Labels:      []string{req.Category, requestLabelPrefix + req.RequestId},
 	}
 
 	torrent, err := s.client.TorrentAdd(ctx, *payload)
@@ -45,12 +51,11 @@ func (s *Server) AddTorrentByMagnet(ctx context.Context, req *transmissionpb.Add
 }
 
 func (s *Server) AddTorrentByFile(ctx context.Context, req *transmissionpb.AddTorrentByFileRequest) (*transmissionpb.AddTorrentResponse, error) {
-	paused := false
 	payload := &transmissionrpc.TorrentAddPayload{
 		MetaInfo:    &req.Base64File,
 		DownloadDir: &req.Filedir,
-		Paused:      &paused,
-		Labels:      []string{req.Category},
+		Paused:      &req.Paused,
+		Labels:      []string{req.Category, requestLabelPrefix + req.RequestId},
 	}
 
 	torrent, err := s.client.TorrentAdd(ctx, *payload)
@@ -79,39 +84,337 @@ func (s *Server) GetTorrentStatus(ctx context.Context, req *transmissionpb.GetTo
 		return nil, status.Error(codes.NotFound, "torrent not found")
 	}
 
-	t := torrent[0]
-	status := transmissionpb.TorrentStatus_STATUS_UNSPECIFIED
-
-	switch {
-	case *t.Status == transmissionrpc.TorrentStatusStopped:
-		status = transmissionpb.TorrentStatus_STATUS_STOPPED
-	case *t.Status == transmissionrpc.TorrentStatusCheckWait:
-		status = transmissionpb.TorrentStatus_STATUS_IN_PROGRESS
-	case *t.Status == transmissionrpc.TorrentStatusCheck:
-		status = transmissionpb.TorrentStatus_STATUS_IN_PROGRESS
-	case *t.Status == transmissionrpc.TorrentStatusDownloadWait:
-		status = transmissionpb.TorrentStatus_STATUS_IN_PROGRESS
-	case *t.Status == transmissionrpc.TorrentStatusDownload:
-		status = transmissionpb.TorrentStatus_STATUS_IN_PROGRESS
-	case *t.Status == transmissionrpc.TorrentStatusSeedWait:
-		status = transmissionpb.TorrentStatus_STATUS_DONE
-	case *t.Status == transmissionrpc.TorrentStatusSeed:
-		status = transmissionpb.TorrentStatus_STATUS_DONE
-	case *t.Status == transmissionrpc.TorrentStatusIsolated:
-		status = transmissionpb.TorrentStatus_STATUS_ERROR
+	return statusResponse(torrent[0]), nil
+}
+
+func (s *Server) GetTorrentsStatus(ctx context.Context, req *transmissionpb.GetTorrentsStatusRequest) (*transmissionpb.GetTorrentsStatusResponse, error) {
+	var torrents []transmissionrpc.Torrent
+
+	// Empty IDs would return every torrent
+	if len(req.TorrentIds) > 0 {
+		byID, err := s.client.TorrentGet(ctx, fields, req.TorrentIds)
+		if err != nil {
+			log.Printf("failed to get torrents status (ids: %v): %v", req.TorrentIds, err)
+			return nil, status.Errorf(codes.Internal, "failed to get torrents status: %v", err)
+		}
+		torrents = append(torrents, byID...)
+	}
+
+	if len(req.Hashes) > 0 {
+		byHash, err := s.client.TorrentGetHashes(ctx, fields, req.Hashes)
+		if err != nil {
+			log.Printf("failed to get torrents status (hashes: %v): %v", req.Hashes, err)
+			return nil, status.Errorf(codes.Internal, "failed to get torrents status: %v", err)
+		}
+		torrents = append(torrents, byHash...)
 	}
 
+	statuses := make([]*transmissionpb.GetTorrentStatusResponse, 0, len(torrents))
+	for _, t := range torrents {
+		statuses = append(statuses, statusResponse(t))
+	}
+
+	return &transmissionpb.GetTorrentsStatusResponse{Torrents: statuses}, nil
+}
+
+func statusResponse(t transmissionrpc.Torrent) *transmissionpb.GetTorrentStatusResponse {
 	return &transmissionpb.GetTorrentStatusResponse{
-		TorrentId:       *t.ID,
-		Name:            *t.Name,
-		Progress:        *t.PercentDone * 100,
-		SizeBytes:       int64(*t.TotalSize),
-		DownloadedBytes: *t.HaveValid,
-		UploadedBytes:   *t.HaveUnchecked,
-		Status:          status,
-		DownloadRate:    int32(*t.RateDownload),
-		Eta:             int32(*t.ETA),
+		TorrentId:          *t.ID,
+		Name:               *t.Name,
+		Progress:           *t.PercentDone * 100,
+		SizeBytes:          int64(t.TotalSize.Byte()),
+		DownloadedBytes:    *t.HaveValid,
+		UploadedBytes:      valueOrZero(t.UploadedEver),
+		Status:             torrentStatus(t),
+		State:              torrentState(t),
+		DownloadRate:       int32(*t.RateDownload),
+		Eta:                int32(*t.ETA),
+		UploadRatio:        *t.UploadRatio,
+		SecondsSeeding:     int64(t.TimeSeeding.Seconds()),
+		Hash:               valueOrZero(t.HashString),
+		UploadRate:         int32(valueOrZero(t.RateUpload)),
+		PeersConnected:     int32(valueOrZero(t.PeersConnected)),
+		PeersSendingToUs:   int32(valueOrZero(t.PeersSendingToUs)),
+		PeersGettingFromUs: int32(valueOrZero(t.PeersGettingFromUs)),
+		TrackerStatus:      trackerStatus(t.TrackerStats),
+		ErrorString:        valueOrZero(t.ErrorString),
+	}
+}
+
+// trackerStatus summarizes the last announce of the first tracker that succeeded, or of the first tracker
+func trackerStatus(stats []transmissionrpc.TrackerStats) string {
+	if len(stats) == 0 {
+		return ""
+	}
+
+	best := stats[0]
+	for _, stat := range stats {
+		if stat.LastAnnounceSucceeded {
+			best = stat
+			break
+		}
+	}
+
+	if !best.HasAnnounced {
+		return best.Host + ": not announced yet"
+	}
+	if best.LastAnnounceSucceeded {
+		return fmt.Sprintf("%s: ok, %d seeders, %d leechers", best.Host, best.SeederCount, best.LeecherCount)
+	}
+	return best.Host + ": " + best.LastAnnounceResult
+}
+
+// transmissionLocalError is the error code of local errors, e.g. a full disk, which stop the torrent.
+// Tracker warnings and errors (1 and 2) don't stop it.
+const transmissionLocalError = 3
+
+// torrentStatus maps a Transmission torrent to a TorrentStatus
+func torrentStatus(t transmissionrpc.Torrent) transmissionpb.TorrentStatus {
+	if valueOrZero(t.Error) == transmissionLocalError {
+		return transmissionpb.TorrentStatus_STATUS_ERROR
+	}
+
+	switch valueOrZero(t.Status) {
+	case transmissionrpc.TorrentStatusStopped:
+		return transmissionpb.TorrentStatus_STATUS_STOPPED
+	case transmissionrpc.TorrentStatusCheckWait,
+		transmissionrpc.TorrentStatusCheck,
+		transmissionrpc.TorrentStatusDownloadWait,
+		transmissionrpc.TorrentStatusDownload:
+		return transmissionpb.TorrentStatus_STATUS_IN_PROGRESS
+	case transmissionrpc.TorrentStatusSeedWait,
+		transmissionrpc.TorrentStatusSeed:
+		return transmissionpb.TorrentStatus_STATUS_DONE
+	case transmissionrpc.TorrentStatusIsolated:
+		return transmissionpb.TorrentStatus_STATUS_ERROR
+	default:
+		return transmissionpb.TorrentStatus_STATUS_UNSPECIFIED
+	}
+}
+
+// torrentState maps a Transmission torrent to a detailed TorrentState
+func torrentState(t transmissionrpc.Torrent) transmissionpb.TorrentState {
+	if valueOrZero(t.Error) == transmissionLocalError {
+		return transmissionpb.TorrentState_STATE_ERROR
+	}
+
+	switch valueOrZero(t.Status) {
+	case transmissionrpc.TorrentStatusStopped:
+		// isFinished is set when the seed ratio or idle limit was reached
+		if valueOrZero(t.IsFinished) || valueOrZero(t.PercentDone) >= 1 {
+			return transmissionpb.TorrentState_STATE_FINISHED
+		}
+		return transmissionpb.TorrentState_STATE_PAUSED
+	case transmissionrpc.TorrentStatusCheckWait, transmissionrpc.TorrentStatusCheck:
+		return transmissionpb.TorrentState_STATE_VERIFYING
+	case transmissionrpc.TorrentStatusDownloadWait:
+		return transmissionpb.TorrentState_STATE_QUEUED
+	case transmissionrpc.TorrentStatusDownload:
+		if t.MetadataPercentComplete != nil && *t.MetadataPercentComplete < 1 {
+			return transmissionpb.TorrentState_STATE_METADATA
+		}
+		return transmissionpb.TorrentState_STATE_DOWNLOADING
+	case transmissionrpc.TorrentStatusSeedWait, transmissionrpc.TorrentStatusSeed:
+		return transmissionpb.TorrentState_STATE_SEEDING
+	case transmissionrpc.TorrentStatusIsolated:
+		return transmissionpb.TorrentState_STATE_ERROR
+	default:
+		return transmissionpb.TorrentState_STATE_UNSPECIFIED
+	}
+}
+
+func (s *Server) ListTorrents(ctx context.Context, req *transmissionpb.ListTorrentsRequest) (*transmissionpb.ListTorrentsResponse, error) {
+	torrents, err := s.client.TorrentGet(ctx, listFields, nil)
+	if err != nil {
+		log.Printf("failed to list torrents: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to list torrents: %v", err)
+	}
+
+	summaries := make([]*transmissionpb.TorrentSummary, 0, len(torrents))
+	for _, t := range torrents {
+		summary := &transmissionpb.TorrentSummary{
+			TorrentId:   valueOrZero(t.ID),
+			Name:        valueOrZero(t.Name),
+			Status:      torrentStatus(t),
+			State:       torrentState(t),
+			Progress:    valueOrZero(t.PercentDone) * 100,
+			SizeBytes:   int64(valueOrZero(t.TotalSize).Byte()),
+			Labels:      t.Labels,
+			DownloadDir: valueOrZero(t.DownloadDir),
+		}
+
+		if matchesListFilter(summary, req) {
+			summaries = append(summaries, summary)
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].TorrentId < summaries[j].TorrentId })
+	return &transmissionpb.ListTorrentsResponse{Torrents: summaries}, nil
+}
+
+// matchesListFilter reports whether a torrent matches the label and status filters of a list request
+func matchesListFilter(summary *transmissionpb.TorrentSummary, req *transmissionpb.ListTorrentsRequest) bool {
+	if req.Status != transmissionpb.TorrentStatus_STATUS_UNSPECIFIED && summary.Status != req.Status {
+		return false
+	}
+	return req.Label == "" || slices.Contains(summary.Labels, req.Label)
+}
+
+func (s *Server) GetTorrentFiles(ctx context.Context, req *transmissionpb.GetTorrentFilesRequest) (*transmissionpb.GetTorrentFilesResponse, error) {
+	torrent, err := s.client.TorrentGet(ctx, []string{"downloadDir", "files"}, []int64{req.TorrentId})
+	if err != nil {
+		log.Printf("failed to get torrent files (id: %d): %v", req.TorrentId, err)
+		return nil, status.Errorf(codes.Internal, "failed to get torrent files: %v", err)
+	}
+
+	if len(torrent) == 0 {
+		return nil, status.Error(codes.NotFound, "torrent not found")
+	}
+
+	t := torrent[0]
+	files := make([]*transmissionpb.TorrentFile, 0, len(t.Files))
+	for _, f := range t.Files {
+		files = append(files, &transmissionpb.TorrentFile{
+			Name:           f.Name,
+			SizeBytes:      f.Length,
+			CompletedBytes: f.BytesCompleted,
+		})
+	}
+
+	return &transmissionpb.GetTorrentFilesResponse{
+		DownloadDir: valueOrZero(t.DownloadDir),
+		Files:       files,
 	}, nil
 }
 
-var fields = []string{"id", "status", "name", "percentDone", "totalSize", "haveValid", "haveUnchecked", "rateDownload", "eta"}
+func (s *Server) StartTorrents(ctx context.Context, req *transmissionpb.StartTorrentsRequest) (*transmissionpb.StartTorrentsResponse, error) {
+	if err := s.client.TorrentStartIDs(ctx, req.TorrentIds); err != nil {
+		log.Printf("failed to start torrents (ids: %v): %v", req.TorrentIds, err)
+		return nil, status.Errorf(codes.Internal, "failed to start torrents: %v", err)
+	}
+
+	log.Printf("torrents started: %v", req.TorrentIds)
+	return &transmissionpb.StartTorrentsResponse{}, nil
+}
+
+func (s *Server) StopTorrents(ctx context.Context, req *transmissionpb.StopTorrentsRequest) (*transmissionpb.StopTorrentsResponse, error) {
+	if err := s.client.TorrentStopIDs(ctx, req.TorrentIds); err != nil {
+		log.Printf("failed to stop torrents (ids: %v): %v", req.TorrentIds, err)
+		return nil, status.Errorf(codes.Internal, "failed to stop torrents: %v", err)
+	}
+
+	log.Printf("torrents stopped: %v", req.TorrentIds)
+	return &transmissionpb.StopTorrentsResponse{}, nil
+}
+
+func (s *Server) SetSeedLimits(ctx context.Context, req *transmissionpb.SetSeedLimitsRequest) (*transmissionpb.SetSeedLimitsResponse, error) {
+	mode := transmissionrpc.SeedRatioModeGlobal
+	payload := transmissionrpc.TorrentSetPayload{
+		IDs:           []int64{req.TorrentId},
+		SeedRatioMode: &mode,
+	}
+	if req.RatioLimit > 0 {
+		mode = transmissionrpc.SeedRatioModeCustom
+		payload.SeedRatioLimit = &req.RatioLimit
+	}
+
+	if err := s.client.TorrentSet(ctx, payload); err != nil {
+		log.Printf("failed to set seed limits (id: %d): %v", req.TorrentId, err)
+		return nil, status.Errorf(codes.Internal, "failed to set seed limits: %v", err)
+	}
+
+	log.Printf("seed limits set (id: %d): ratio: %.2f", req.TorrentId, req.RatioLimit)
+	return &transmissionpb.SetSeedLimitsResponse{}, nil
+}
+
+func (s *Server) RemoveTorrent(ctx context.Context, req *transmissionpb.RemoveTorrentRequest) (*transmissionpb.RemoveTorrentResponse, error) {
+	payload := transmissionrpc.TorrentRemovePayload{
+		IDs:             []int64{req.TorrentId},
+		DeleteLocalData: req.DeleteLocalData,
+	}
+
+	if err := s.client.TorrentRemove(ctx, payload); err != nil {
+		log.Printf("failed to remove torrent (id: %d): %v", req.TorrentId, err)
+		return nil, status.Errorf(codes.Internal, "failed to remove torrent: %v", err)
+	}
+
+	log.Printf("torrent removed (id: %d, deleteLocalData: %t)", req.TorrentId, req.DeleteLocalData)
+	return &transmissionpb.RemoveTorrentResponse{}, nil
+}
+
+func (s *Server) GetFreeSpace(ctx context.Context, req *transmissionpb.GetFreeSpaceRequest) (*transmissionpb.GetFreeSpaceResponse, error) {
+	free, total, err := s.client.FreeSpace(ctx, req.Path)
+	if err != nil {
+		log.Printf("failed to get free space (path: %s): %v", req.Path, err)
+		return nil, status.Errorf(codes.Internal, "failed to get free space: %v", err)
+	}
+
+	return &transmissionpb.GetFreeSpaceResponse{
+		Path:       req.Path,
+		FreeBytes:  int64(free.Byte()),
+		TotalBytes: int64(total.Byte()),
+	}, nil
+}
+
+func (s *Server) GetSession(ctx context.Context, req *transmissionpb.GetSessionRequest) (*transmissionpb.SessionSettings, error) {
+	return s.getSessionSettings(ctx)
+}
+
+func (s *Server) SetSession(ctx context.Context, req *transmissionpb.SetSessionRequest) (*transmissionpb.SessionSettings, error) {
+	payload := transmissionrpc.SessionArguments{
+		AltSpeedEnabled:       req.AltSpeedEnabled,
+		SpeedLimitDownEnabled: req.SpeedLimitDownEnabled,
+		SpeedLimitDown:        req.SpeedLimitDown,
+		SpeedLimitUpEnabled:   req.SpeedLimitUpEnabled,
+		SpeedLimitUp:          req.SpeedLimitUp,
+		AltSpeedDown:          req.AltSpeedDown,
+		AltSpeedUp:            req.AltSpeedUp,
+	}
+
+	if err := s.client.SessionArgumentsSet(ctx, payload); err != nil {
+		log.Printf("failed to set session arguments: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to set session: %v", err)
+	}
+
+	return s.getSessionSettings(ctx)
+}
+
+func (s *Server) getSessionSettings(ctx context.Context) (*transmissionpb.SessionSettings, error) {
+	args, err := s.client.SessionArgumentsGet(ctx, sessionFields)
+	if err != nil {
+		log.Printf("failed to get session arguments: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get session: %v", err)
+	}
+
+	stats, err := s.client.SessionStats(ctx)
+	if err != nil {
+		log.Printf("failed to get session stats: %v", err)
+		return nil, status.Errorf(codes.Internal, "failed to get session stats: %v", err)
+	}
+
+	return &transmissionpb.SessionSettings{
+		AltSpeedEnabled:       valueOrZero(args.AltSpeedEnabled),
+		SpeedLimitDownEnabled: valueOrZero(args.SpeedLimitDownEnabled),
+		SpeedLimitDown:        valueOrZero(args.SpeedLimitDown),
+		SpeedLimitUpEnabled:   valueOrZero(args.SpeedLimitUpEnabled),
+		SpeedLimitUp:          valueOrZero(args.SpeedLimitUp),
+		AltSpeedDown:          valueOrZero(args.AltSpeedDown),
+		AltSpeedUp:            valueOrZero(args.AltSpeedUp),
+		DownloadRate:          stats.DownloadSpeed,
+		UploadRate:            stats.UploadSpeed,
+	}, nil
+}
+
+func valueOrZero[T any](v *T) T {
+	var zero T
+	if v == nil {
+		return zero
+	}
+	return *v
+}
+
+var sessionFields = []string{"alt-speed-enabled", "speed-limit-down-enabled", "speed-limit-down", "speed-limit-up-enabled", "speed-limit-up", "alt-speed-down", "alt-speed-up"}
+
+var listFields = []string{"id", "status", "name", "percentDone", "totalSize", "labels", "downloadDir", "error", "isFinished", "metadataPercentComplete"}
+
+var fields = []string{"id", "hashString", "status", "name", "percentDone", "totalSize", "haveValid", "uploadedEver", "rateDownload", "rateUpload", "eta", "uploadRatio", "secondsSeeding", "peersConnected", "peersSendingToUs", "peersGettingFromUs", "trackerStats", "errorString", "error", "isFinished", "metadataPercentComplete"}
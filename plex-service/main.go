@@ -1,19 +1,26 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	"time"
 
 	common "github.com/aquare11e/media-downloader-bot/common/protogen/common"
 	protoPlex "github.com/aquare11e/media-downloader-bot/common/protogen/plex"
+	"github.com/aquare11e/media-downloader-bot/internal/paths"
 	plexClient "github.com/aquare11e/media-downloader-bot/internal/plex"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
 
+const (
+	discoveryTimeout = 30 * time.Second
+)
+
 func main() {
 	// Use an environment variable for the address
 	servicePort := os.Getenv("SERVICE_PORT")
@@ -23,14 +30,36 @@ func main() {
 		log.Fatalf("Environment variable SERVICE_PORT is not set")
 	}
 
-	plexBaseURL := fmt.Sprintf("http://%s:%s", getEnvOrRaise("PLEX_HOST"), getEnvOrRaise("PLEX_PORT"))
-	plexToken := getEnvOrRaise("PLEX_TOKEN")
-	pbTypeToCategoryId := map[common.RequestType]string{
-		common.RequestType_FILMS:           getEnvOrRaise("PLEX_CATEGORY_FILMS"),
-		common.RequestType_SERIES:          getEnvOrRaise("PLEX_CATEGORY_SERIES"),
-		common.RequestType_CARTOONS:        getEnvOrRaise("PLEX_CATEGORY_CARTOONS"),
-		common.RequestType_CARTOONS_SERIES: getEnvOrRaise("PLEX_CATEGORY_CARTOONS_SERIES"),
-		common.RequestType_SHORTS:          getEnvOrRaise("PLEX_CATEGORY_SHORTS"),
+	// Section IDs or titles, sections are discovered for the categories that are not set
+	configuredSections := map[common.RequestType]string{
+		common.RequestType_FILMS:           os.Getenv("PLEX_CATEGORY_FILMS"),
+		common.RequestType_SERIES:          os.Getenv("PLEX_CATEGORY_SERIES"),
+		common.RequestType_CARTOONS:        os.Getenv("PLEX_CATEGORY_CARTOONS"),
+		common.RequestType_CARTOONS_SERIES: os.Getenv("PLEX_CATEGORY_CARTOONS_SERIES"),
+		common.RequestType_SHORTS:          os.Getenv("PLEX_CATEGORY_SHORTS"),
+	}
+
+	// Category download paths, used to match sections by location
+	downloadPaths := map[common.RequestType]string{
+		common.RequestType_FILMS:           os.Getenv("FILMS_DIR_PATH"),
+		common.RequestType_SERIES:          os.Getenv("SERIES_DIR_PATH"),
+		common.RequestType_CARTOONS:        os.Getenv("CARTOONS_DIR_PATH"),
+		common.RequestType_CARTOONS_SERIES: os.Getenv("CARTOONS_SERIES_DIR_PATH"),
+		common.RequestType_SHORTS:          os.Getenv("SHORTS_DIR_PATH"),
+	}
+
+	pathMapping, err := paths.ParseMapping(os.Getenv("PLEX_PATH_MAPPING"))
+	if err != nil {
+		log.Fatalf("Failed to parse PLEX_PATH_MAPPING: %v", err)
+	}
+
+	mediaServer := newMediaServer(os.Getenv("MEDIA_SERVER"), pathMapping)
+
+	ctx, cancel := context.WithTimeout(context.Background(), discoveryTimeout)
+	err = mediaServer.DiscoverSections(ctx, configuredSections, downloadPaths)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to discover library sections: %v", err)
 	}
 
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", servicePort))
@@ -39,7 +68,7 @@ func main() {
 	}
 
 	server := grpc.NewServer()
-	protoPlex.RegisterPlexServiceServer(server, plexClient.NewPlexService(plexBaseURL, plexToken, pbTypeToCategoryId))
+	protoPlex.RegisterPlexServiceServer(server, plexClient.NewPlexService(mediaServer))
 	reflection.Register(server)
 
 	log.Printf("server listening at %v", listener.Addr())
@@ -48,6 +77,20 @@ func main() {
 	}
 }
 
+// newMediaServer creates the client of the configured media server, Plex by default
+func newMediaServer(kind string, pathMapping paths.Mapping) plexClient.MediaServer {
+	switch kind {
+	case "", "plex":
+		plexBaseURL := fmt.Sprintf("http://%s:%s", getEnvOrRaise("PLEX_HOST"), getEnvOrRaise("PLEX_PORT"))
+		return plexClient.NewClient(plexBaseURL, getEnvOrRaise("PLEX_TOKEN"), nil, pathMapping)
+	case "jellyfin", "emby":
+		return plexClient.NewJellyfinClient(getEnvOrRaise("JELLYFIN_URL"), getEnvOrRaise("JELLYFIN_API_KEY"), kind == "emby", pathMapping)
+	default:
+		log.Fatalf("Unknown MEDIA_SERVER %q, expected plex, jellyfin or emby", kind)
+		return nil
+	}
+}
+
 func getEnvOrRaise(key string) string {
 	value := os.Getenv(key)
 	if value == "" {
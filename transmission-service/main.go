@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
 	"net/url"
 	"os"
+	"time"
 
 	transmissionpb "github.com/aquare11e/media-downloader-bot/common/protogen/transmission"
 	"github.com/aquare11e/media-downloader-bot/internal/transmission"
@@ -14,13 +16,44 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
+// loginTimeout bounds the qBittorrent login at startup
+const loginTimeout = 30 * time.Second
+
 func main() {
-	// Get environment variables
+	torrentClient := getEnvOrDefault("TORRENT_CLIENT", "transmission")
+	servicePort := getEnvOrDefault("SERVICE_PORT", "50052")
+
+	var server transmissionpb.TransmissionServiceServer
+	switch torrentClient {
+	case "transmission":
+		server = newTransmissionServer()
+	case "qbittorrent":
+		server = newQBittorrentServer()
+	default:
+		log.Fatalf("Unknown TORRENT_CLIENT %q, expected transmission or qbittorrent", torrentClient)
+	}
+
+	// Create gRPC server
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", servicePort))
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	s := grpc.NewServer()
+	transmissionpb.RegisterTransmissionServiceServer(s, server)
+	reflection.Register(s)
+
+	log.Printf("Server listening at %v (client: %s)", lis.Addr(), torrentClient)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+func newTransmissionServer() *transmission.Server {
 	transmissionHost := getEnvOrDefault("TRANSMISSION_HOST", "")
 	transmissionPort := getEnvOrDefault("TRANSMISSION_PORT", "")
 	transmissionUser := getEnvOrDefault("TRANSMISSION_USER", "")
 	transmissionPassword := getEnvOrDefault("TRANSMISSION_PASSWORD", "")
-	servicePort := getEnvOrDefault("SERVICE_PORT", "50052")
 
 	// Create the endpoint URL
 	endpoint, err := url.Parse(fmt.Sprintf("http://%s:%s@%s:%s/transmission/rpc", transmissionUser, transmissionPassword, transmissionHost, transmissionPort))
@@ -34,20 +67,26 @@ func main() {
 		log.Fatalf("Failed to create Transmission client: %v", err)
 	}
 
-	// Create gRPC server
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%s", servicePort))
+	return transmission.NewServer(client)
+}
+
+func newQBittorrentServer() *transmission.QBittorrentServer {
+	qbURL := getEnvOrDefault("QBITTORRENT_URL", "http://localhost:8080")
+	qbUser := getEnvOrDefault("QBITTORRENT_USER", "")
+	qbPassword := getEnvOrDefault("QBITTORRENT_PASSWORD", "")
+
+	client, err := transmission.NewQBittorrentClient(qbURL, qbUser, qbPassword)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		log.Fatalf("Failed to create qBittorrent client: %v", err)
 	}
 
-	s := grpc.NewServer()
-	transmissionpb.RegisterTransmissionServiceServer(s, transmission.NewServer(client))
-	reflection.Register(s)
-
-	log.Printf("Server listening at %v", lis.Addr())
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+	defer cancel()
+	if err := client.Login(ctx); err != nil {
+		log.Fatalf("Failed to log in to qBittorrent: %v", err)
 	}
+
+	return transmission.NewQBittorrentServer(client)
 }
 
 func getEnvOrDefault(key, defaultValue string) string {